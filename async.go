@@ -0,0 +1,342 @@
+package lgr
+
+/*
+Asynchronous outputs.
+
+By default the processing goroutine writes every message to the outputs one by
+one, so a hung output (e.g. a network writer) stalls all others. An output
+switched to the async mode (see Logger.SetOutputAsync) gets its own bounded
+queue and writer goroutine:
+  - messages are filtered and formatted by the processing goroutine as usual and
+    queued for the output in the processing order (the order per output is kept)
+  - the writer goroutine writes them with the same error and panic handling
+    (fallback reports, counters, disabling on panic and retries)
+  - if the output queue is full, the message is dropped for this output only;
+    drops are counted (OutputStats.Dropped) and reported to the fallback once
+    the output queue is at most half full
+  - outputs are reopened (see Logger.ReopenOutputs) and Flush barriers are
+    passed by the writer goroutine in the queue order, the processing goroutine
+    doesn't wait for them
+
+Writer goroutines are owned by the processing goroutine, which never waits for
+a hung output:
+  - a writer is started with the first message for the output
+  - on resize (or if the output is replaced) the writer is stopped after writing
+    the queued messages, the new one starts writing after it
+  - switched back to the sync mode the output gets messages through its writer
+    until the queue is written, then the writer is stopped
+  - the writer of a removed output is stopped without waiting
+  - when the logger stops, writers are waited while they make progress; a writer
+    stalled for the stall timeout (plus the output write timeout) is reported
+    to the fallback and left to finish on its own
+  - on restart (see Logger.Restart) the writers keep running and are taken over
+    by the next processing goroutine
+*/
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	_ASYNC_DROPPED_NOTICE_SUFFIX = " log messages dropped on async queue overflow"
+	_ASYNC_STALLED_NOTICE_SUFFIX = " async writer is stalled, the rest of its queue is left to it"
+	_ASYNC_STALL_TIMEOUT         = time.Second // max time without progress of a writer waited on stop
+)
+
+// asyncItem is the unit of an output queue.
+type asyncItem struct {
+	msg   logMessage   // time, client and level of the message (without payload)
+	batch []logMessage // the same for every message of a batch (nil for single messages)
+	data  []byte       // formatted message (or batch)
+	probe bool         // written to a disabled output as a retry probe
+}
+
+// asyncCall is a function called by the writer goroutine after writing a number
+// of queued items (see asyncWriter.after).
+type asyncCall struct {
+	after uint64 // number of items queued before the call
+	f     func()
+}
+
+// asyncWriter is the queue and writer goroutine of an async output.
+type asyncWriter struct {
+	output     OutType
+	context    *outContext
+	queue      chan asyncItem
+	queued     uint64        // number of items queued (by the processing goroutine)
+	mtx        sync.Mutex    // guards calls
+	calls      []asyncCall   // scheduled calls in the queue order
+	wake       chan struct{} // wakes up the writer goroutine waiting for items
+	written    atomic.Uint64 // number of items written (or skipped) by the writer goroutine
+	prev       chan struct{} // done of the previous writer of the output (nil if none)
+	done       chan struct{} // closed on the writer goroutine exit
+	unreported atomic.Uint64 // messages dropped since the previous notice
+}
+
+// Switches the specified output to the async mode with its own queue of buffsize
+// messages and writer goroutine, so a slow output doesn't stall other ones.
+// Non-positive buffsize switches the output back to the sync mode (default).
+//
+// The operation is protected by mutex for thread safety.
+//
+// Changes are applied by the processing goroutine with the next message. The queued
+// messages are written before switching to the sync mode or resizing the queue
+// (without blocking the processing goroutine, see the package notes).
+func (l *Logger) SetOutputAsync(output OutType, buffsize int) *Logger {
+	return l.changeOutSettings(output, func(c *outContext) {
+		c.asyncsize = max(buffsize, 0)
+	})
+}
+
+// Returns the writer of the output according to the async queue size (starts,
+// restarts or stops it if needed). The writer switched to the sync mode is returned
+// until its queue is written. Called by the processing goroutine only.
+func (l *Logger) asyncWriterFor(output OutType, context *outContext, size int) *asyncWriter {
+	aw := l.asyncs[output]
+	switch {
+	case aw == nil || aw.context == context && cap(aw.queue) == size:
+	case aw.context == context && size == 0:
+		if aw.written.Load() != aw.queued {
+			// sync writes must not overtake the queued messages
+			return aw
+		}
+		l.stopAsync(output)
+		l.waitAsync(aw)
+		aw = nil
+	default:
+		// the new writer starts writing after the stopped one
+		l.stopAsync(output)
+		aw = nil
+	}
+	if aw == nil && size > 0 {
+		aw = &asyncWriter{
+			output:  output,
+			context: context,
+			queue:   make(chan asyncItem, size),
+			wake:    make(chan struct{}, 1),
+			prev:    l.asyncPrev[output],
+			done:    make(chan struct{}),
+		}
+		delete(l.asyncPrev, output)
+		if l.asyncs == nil {
+			l.asyncs = map[OutType]*asyncWriter{}
+		}
+		l.asyncs[output] = aw
+		go l.runAsync(aw)
+	}
+	return aw
+}
+
+// Stops the writer of the output after writing the queued messages without waiting.
+// The writer is kept as the previous one of the output until it finishes, so the
+// next writer of the output doesn't write concurrently.
+func (l *Logger) stopAsync(output OutType) {
+	aw := l.asyncs[output]
+	delete(l.asyncs, output)
+	close(aw.queue)
+	for o, done := range l.asyncPrev {
+		select {
+		case <-done:
+			delete(l.asyncPrev, o)
+		default:
+		}
+	}
+	if l.asyncPrev == nil {
+		l.asyncPrev = map[OutType]chan struct{}{}
+	}
+	l.asyncPrev[output] = aw.done
+}
+
+// Waits for the stopped writer while it makes progress. A writer that writes
+// nothing for the stall timeout (plus the output write timeout) is reported to the
+// fallback and left to finish on its own.
+func (l *Logger) waitAsync(aw *asyncWriter) {
+	l.sync.outsMtx.RLock()
+	stall := _ASYNC_STALL_TIMEOUT + aw.context.timeout.limit
+	name := aw.context.name
+	l.sync.outsMtx.RUnlock()
+	timer := time.NewTimer(stall)
+	defer timer.Stop()
+	written := aw.written.Load()
+	for {
+		select {
+		case <-aw.done:
+			return
+		case <-timer.C:
+		}
+		n := aw.written.Load()
+		if n == written {
+			l.handleLogWriteError("output " + name + ":" + _ASYNC_STALLED_NOTICE_SUFFIX)
+			return
+		}
+		written = n
+		timer.Reset(stall)
+	}
+}
+
+// Stops writers of removed outputs without waiting (a hung output must not stall
+// the processing goroutine). Pending batches are queued before stopping.
+func (l *Logger) sweepAsync() {
+	for output, aw := range l.asyncs {
+		if l.outputs[output] != aw.context {
+			if l.batched[output] == aw.context {
+				delete(l.batched, output)
+				l.writeBatch(output, aw.context, false)
+			}
+			l.stopAsync(output)
+		}
+	}
+}
+
+// Stops all writers and waits for them while they make progress (called on the
+// processing goroutine exit unless the logger is restarted).
+func (l *Logger) stopAllAsync() {
+	var wg sync.WaitGroup
+	for output, aw := range l.asyncs {
+		l.stopAsync(output)
+		wg.Go(func() { l.waitAsync(aw) })
+	}
+	wg.Wait()
+}
+
+// Queues a formatted message (or batch) for the output writer. The item is dropped
+// if the output queue is full.
+func (l *Logger) pushAsync(aw *asyncWriter, item asyncItem) {
+	select {
+	case aw.queue <- item:
+		aw.queued++
+	default:
+		n := uint64(max(len(item.batch), 1))
+		aw.context.stats.dropped.Add(n)
+		aw.unreported.Add(n)
+		if item.probe {
+			// the probe is lost, schedule the next one
+			l.outputFailed(aw.output, aw.context, nil)
+		}
+	}
+}
+
+// Queues the formatted message (the content of msgbuf) for the output writer.
+func (l *Logger) pushAsyncMessage(aw *asyncWriter, msg *logMessage, probe bool) {
+	l.pushAsync(aw, asyncItem{
+		msg:   logMessage{pushed: msg.pushed, msgclnt: msg.msgclnt, msgtype: msg.msgtype, annex: msg.annex},
+		data:  bytes.Clone(l.msgbuf.Bytes()),
+		probe: probe,
+	})
+	l.msgbuf.Reset()
+}
+
+// Schedules f to be called by the writer goroutine after writing the items queued
+// before. The caller doesn't wait, so a hung output can't stall it (called by the
+// processing goroutine only).
+func (aw *asyncWriter) after(f func()) {
+	aw.mtx.Lock()
+	aw.calls = append(aw.calls, asyncCall{after: aw.queued, f: f})
+	aw.mtx.Unlock()
+	select {
+	case aw.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Calls the scheduled functions due after writing n items (all of them if all is set).
+func (aw *asyncWriter) runCalls(n uint64, all bool) {
+	aw.mtx.Lock()
+	i := 0
+	for i < len(aw.calls) && (all || aw.calls[i].after <= n) {
+		i++
+	}
+	due := aw.calls[:i:i]
+	aw.calls = aw.calls[i:]
+	aw.mtx.Unlock()
+	for _, call := range due {
+		call.f()
+	}
+}
+
+// Writer goroutine loop.
+func (l *Logger) runAsync(aw *asyncWriter) {
+	defer close(aw.done)
+	if aw.prev != nil {
+		// the previous writer of the output is still writing its queue
+		<-aw.prev
+	}
+	for {
+		aw.runCalls(aw.written.Load(), false)
+		select {
+		case item, ok := <-aw.queue:
+			if !ok {
+				aw.runCalls(aw.written.Load(), true)
+				l.reportAsyncDropped(aw, true)
+				return
+			}
+			if l.abandon.Load() {
+				// the shutdown deadline is exceeded
+				l.abandoned.Add(uint64(max(len(item.batch), 1)))
+			} else {
+				l.writeAsync(aw, &item)
+				l.reportAsyncDropped(aw, false)
+			}
+			aw.written.Add(1)
+		case <-aw.wake:
+		}
+	}
+}
+
+// Writes a queued message to the output. Messages queued before the output was
+// disabled are skipped (except probes).
+func (l *Logger) writeAsync(aw *asyncWriter, item *asyncItem) {
+	l.sync.outsMtx.RLock()
+	enabled := aw.context.enabled
+	l.sync.outsMtx.RUnlock()
+	if !enabled && !item.probe {
+		return
+	}
+	pushed := item.msg.pushed
+	if item.batch != nil {
+		pushed = item.batch[0].pushed
+	}
+	n, panicked, err := l.writeData(aw.output, aw.context, item.data, pushed)
+	switch {
+	case err != nil:
+	case item.batch != nil:
+		l.countBatchWritten(aw.context, item.batch, n)
+	default:
+		l.countWritten(aw.context, &item.msg, n)
+	}
+	l.outputWritten(aw.output, aw.context, item.probe, panicked, err)
+}
+
+// Writes data to the output in a single write call converting a panic into an error.
+func (l *Logger) writeData(output OutType, context *outContext, data []byte, pushed time.Time) (n int64, panicked bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			panicked = true
+			err = errors.New("panic writing log to output" + panicDesc(r))
+		}
+	}()
+	n, e := l.writeOutput(output, context, bytes.NewBuffer(data), pushed)
+	if e != nil {
+		err = newWriteError(n, e)
+	}
+	return n, false, err
+}
+
+// Writes the notice about messages dropped for the output since the previous notice
+// to the fallback. With force false the notice is written only if the output queue
+// is at most half full.
+func (l *Logger) reportAsyncDropped(aw *asyncWriter, force bool) {
+	if aw.unreported.Load() == 0 || (!force && len(aw.queue) > cap(aw.queue)/2) {
+		return
+	}
+	n := aw.unreported.Swap(0)
+	l.sync.outsMtx.RLock()
+	name := aw.context.name
+	l.sync.outsMtx.RUnlock()
+	l.handleLogWriteError("output " + name + ": " + strconv.FormatUint(n, 10) + _ASYNC_DROPPED_NOTICE_SUFFIX)
+}
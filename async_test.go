@@ -0,0 +1,232 @@
+package lgr
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// GateWriter blocks writes until the gate is opened.
+type GateWriter struct {
+	gate chan struct{}
+	once sync.Once
+	mtx  sync.Mutex
+	FakeWriter
+	reopens int
+}
+
+func NewGateWriter() *GateWriter { return &GateWriter{gate: make(chan struct{})} }
+
+func (g *GateWriter) Write(b []byte) (int, error) {
+	<-g.gate
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	return g.FakeWriter.Write(b)
+}
+
+func (g *GateWriter) Reopen() error {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	g.reopens++
+	g.FakeWriter.Write([]byte("<reopen>\n"))
+	return nil
+}
+
+func (g *GateWriter) Open() { g.once.Do(func() { close(g.gate) }) }
+
+func (g *GateWriter) String() string {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	return g.FakeWriter.String()
+}
+
+func Test_Logger_SetOutputAsync(t *testing.T) {
+	slow, fast := NewGateWriter(), NewGateWriter()
+	fast.Open()
+	l := InitWithParams(LVL_UNKNOWN, &FakeWriter{}, slow, fast)
+	l.SetOutputAsync(slow, 16)
+	assert.Equal(t, 16, l.outputs[slow].asyncsize)
+	l.SetOutputAsync(fast, -1)
+	assert.Zero(t, l.outputs[fast].asyncsize)
+	lc := l.NewClient("c")
+	l.Start(4)
+	want := ""
+	for _, s := range []string{"a", "b", "c", "d", "e", "f"} {
+		lc.LogInfo(s)
+		want += "c:" + s + "\n"
+	}
+	l.ReopenOutputs() // the reopen is queued for slow without waiting
+	lc.LogInfo("g")
+	// fast output gets all messages while slow one is stalled
+	want2 := want + "<reopen>\n<COMMAND: type=2 annex=5 data=``>\nc:g\n"
+	assert.Eventually(t, func() bool { return fast.String() == want2 }, time.Second, time.Millisecond)
+	assert.Empty(t, slow.String())
+	assert.Zero(t, slow.reopens)
+	slow.Open()
+	l.StopAndWait()
+	assert.Equal(t, want+"<reopen>\n<COMMAND: type=2 annex=5 data=``>\nc:g\n", slow.String(), "wrong order of async output")
+	assert.Empty(t, l.asyncs, "writers are not stopped")
+	for _, o := range l.Stats().Outputs {
+		assert.Equal(t, uint64(7), o.Written[LVL_INFO], o.Name)
+		assert.Zero(t, o.Dropped, o.Name)
+	}
+}
+
+func Test_Logger_AsyncReopen_Hung(t *testing.T) {
+	hung, healthy, ferr := NewGateWriter(), &FakeWriter{}, &FakeWriter{}
+	l := InitWithParams(LVL_UNKNOWN, ferr, hung, healthy)
+	l.SetOutputAsync(hung, 1).SetOutputName(healthy, "healthy")
+	lc := l.NewClient("")
+	l.Start(4)
+	for range 4 {
+		lc.LogInfo("x")
+	}
+	l.ReopenOutputs()
+	l.ReopenOutputs()
+	lc.LogInfo("after")
+	assert.Eventually(t, func() bool {
+		for _, o := range l.Stats().Outputs {
+			if o.Name == "healthy" {
+				return o.Written[LVL_INFO] == 5
+			}
+		}
+		return false
+	}, time.Second, time.Millisecond, "processing goroutine is stalled by the hung output")
+	hung.Open()
+	l.StopAndWait()
+	assert.Equal(t, 2, hung.reopens)
+	assert.True(t, strings.HasSuffix(healthy.String(), ":after\n"))
+}
+
+func Test_Logger_AsyncRestart(t *testing.T) {
+	hung, healthy := NewGateWriter(), &FakeWriter{}
+	l := InitWithParams(LVL_UNKNOWN, &FakeWriter{}, hung, healthy)
+	l.SetOutputAsync(hung, 4).SetOutputName(healthy, "healthy")
+	lc := l.NewClient("")
+	l.Start(4)
+	lc.LogInfo("a")
+	aw := func() *asyncWriter {
+		l.sync.procMtx.Lock()
+		defer l.sync.procMtx.Unlock()
+		return l.asyncs[hung]
+	}
+	assert.Eventually(t, func() bool { return aw() != nil }, time.Second, time.Millisecond)
+	first := aw()
+	l.Restart(16)
+	lc.LogInfo("b")
+	assert.Eventually(t, func() bool {
+		for _, o := range l.Stats().Outputs {
+			if o.Name == "healthy" {
+				return o.Written[LVL_INFO] == 2
+			}
+		}
+		return false
+	}, time.Second, time.Millisecond, "restart waits for the hung output")
+	assert.Same(t, first, aw(), "writer is not taken over")
+	hung.Open()
+	l.StopAndWait()
+	assert.Equal(t, ":a\n:b\n", hung.String())
+	assert.Empty(t, l.asyncs, "writers are not stopped")
+}
+
+func Test_Logger_AsyncOverflow(t *testing.T) {
+	slow, ferr := NewGateWriter(), &FakeWriter{}
+	l := InitWithParams(LVL_UNKNOWN, ferr, slow)
+	l.SetOutputName(slow, "slow").SetOutputAsync(slow, 2)
+	lc := l.NewClient("")
+	l.Start(4)
+	for range 10 {
+		lc.LogInfo("x")
+	}
+	// the logger queue is drained despite the stalled output
+	assert.Eventually(t, func() bool { return l.Stats().Outputs[0].Dropped >= 7 }, time.Second, time.Millisecond)
+	slow.Open()
+	l.StopAndWait()
+	s := l.Stats().Outputs[0]
+	assert.Equal(t, uint64(10), s.Written[LVL_INFO]+s.Dropped, "messages are lost without counting")
+	assert.Equal(t, strings.Repeat(":x\n", int(s.Written[LVL_INFO])), slow.String())
+	assert.Contains(t, ferr.String(), "output slow: "+strconv.FormatUint(s.Dropped, 10)+_ASYNC_DROPPED_NOTICE_SUFFIX)
+}
+
+func Test_Logger_AsyncPanic(t *testing.T) {
+	out, ferr := &FlakyWriter{broken: true}, &FakeWriter{}
+	l := InitWithParams(LVL_UNKNOWN, ferr, out)
+	l.SetOutputAsync(out, 4).SetOutputRetry(out, time.Millisecond, time.Millisecond)
+	enabled := make(chan bool, 2)
+	l.SetOutputStateHandler(func(_ OutType, _ string, e bool, _ error) { enabled <- e })
+	lc := l.NewClient("")
+	l.Start(4)
+	lc.LogInfo("a")
+	assert.False(t, <-enabled)
+	assert.Contains(t, ferr.String(), panicStr)
+	out.broken = false // safe: the output is not written until the next probe
+	time.Sleep(2 * time.Millisecond)
+	lc.LogInfo("b")
+	assert.True(t, <-enabled)
+	lc.LogInfo("c")
+	l.StopAndWait()
+	assert.Equal(t, ":b\n:c\n", out.String())
+	assert.Equal(t, uint64(1), l.Stats().Outputs[0].Panics)
+}
+
+func Test_Logger_AsyncSwitch(t *testing.T) {
+	out1, out2 := &FakeWriter{}, &FakeWriter{}
+	l := InitWithParams(LVL_UNKNOWN, &FakeWriter{}, out1, out2)
+	l.msgbuf = bytes.NewBuffer(make([]byte, DEFAULT_OUT_BUFF))
+	l.SetOutputAsync(out1, 4).SetOutputAsync(out2, 4)
+	msg := &logMessage{msgtype: _MSG_LOG_TEXT, msgdata: []byte("a"), annex: basetype(LVL_INFO)}
+	l.logTextToOutputs(msg)
+	assert.Len(t, l.asyncs, 2, "writers are not started")
+	aw1 := l.asyncs[out1]
+	l.SetOutputAsync(out1, 8)
+	l.logTextToOutputs(msg)
+	aw := l.asyncs[out1]
+	assert.NotSame(t, aw1, aw, "writer is not restarted on resize")
+	assert.Equal(t, aw1.done, aw.prev, "new writer is not chained after the old one")
+	l.SetOutputAsync(out1, 0)
+	assert.Eventually(t, func() bool { return aw.written.Load() == aw.queued }, time.Second, time.Millisecond)
+	<-aw1.done
+	assert.Equal(t, "a\na\n", out1.String())
+	l.RemoveOutputs(out2)
+	aw2 := l.asyncs[out2]
+	l.logTextToOutputs(msg)
+	assert.Empty(t, l.asyncs, "writers are not stopped")
+	assert.Equal(t, "a\na\na\n", out1.String())
+	<-aw2.done
+	assert.Equal(t, "a\na\n", out2.String())
+}
+
+func Test_Logger_AsyncStall(t *testing.T) {
+	hung, healthy, ferr := NewGateWriter(), &FakeWriter{}, &FakeWriter{}
+	l := InitWithParams(LVL_UNKNOWN, ferr, hung, healthy)
+	l.SetOutputAsync(hung, 4).SetOutputName(hung, "hung").SetOutputName(healthy, "healthy")
+	lc := l.NewClient("")
+	l.Start(4)
+	written := func() uint64 {
+		for _, o := range l.Stats().Outputs {
+			if o.Name == "healthy" {
+				return o.Written[LVL_INFO]
+			}
+		}
+		return 0
+	}
+	lc.LogInfo("a")
+	assert.Eventually(t, func() bool { return written() == 1 }, time.Second, time.Millisecond)
+	l.SetOutputAsync(hung, 8) // resize
+	lc.LogInfo("b")
+	assert.Eventually(t, func() bool { return written() == 2 }, time.Second, time.Millisecond, "stalled on resize")
+	l.SetOutputAsync(hung, 0) // back to the sync mode
+	lc.LogInfo("c")
+	assert.Eventually(t, func() bool { return written() == 3 }, time.Second, time.Millisecond, "stalled on sync mode")
+	start := time.Now()
+	l.StopAndWait()
+	assert.Less(t, time.Since(start), _ASYNC_STALL_TIMEOUT+time.Second, "stalled on stop")
+	assert.Contains(t, ferr.String(), "output hung:"+_ASYNC_STALLED_NOTICE_SUFFIX)
+	hung.Open()
+	assert.Eventually(t, func() bool { return hung.String() == ":a\n:b\n:c\n" }, time.Second, time.Millisecond)
+}
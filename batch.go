@@ -0,0 +1,180 @@
+package lgr
+
+/*
+Batched output writes.
+
+By default every message is written to an output with a separate Write call.
+An output with batching enabled (see Logger.SetOutputBatching) gets formatted
+messages accumulated in its own buffer, which is written with a single call:
+  - when the buffer size reaches the limit
+  - when the flush interval passes since the first buffered message
+  - on messages of ERROR level and above (written immediately with the buffered ones)
+  - on retry probes of a disabled output
+  - when batching is switched off and when the logger stops
+
+Batches are written like single messages: async outputs get them in their queues
+as one item, errors and panics are reported once per batch, and messages are
+counted as written only if the whole batch is written. TimedWriter outputs get
+the time of the first message of a batch, so batches of TimedSplitter outputs
+(like TimeRotatingFile) are written before a message of another destination.
+
+Batches are owned by the processing goroutine (it keeps track of pending batches
+and wakes up to flush them in time).
+*/
+
+import (
+	"bytes"
+	"errors"
+	"time"
+)
+
+const _BATCH_FLUSH_LEVEL = LVL_ERROR // messages of this level and above flush batches
+
+// outBatch holds the batching settings and the pending batch of an output.
+type outBatch struct {
+	limit    int           // buffer size to flush at (zero if batching is off)
+	interval time.Duration // max time to keep a message in the buffer (zero for no limit)
+	buf      bytes.Buffer  // formatted messages
+	msgs     []logMessage  // time, client and level of the buffered messages (no payload)
+	due      time.Time     // flush deadline (zero if no deadline)
+}
+
+// Enables batching of writes to the specified output: formatted messages are
+// accumulated up to size bytes and written with a single call (at most interval
+// after the first one if interval is positive). Messages of ERROR level and above
+// flush the batch immediately. Non-positive size disables batching (default), the
+// pending batch is written with the next message or when the logger stops.
+//
+// A batch is written with the time of its first message (see TimedWriter). For
+// outputs implementing TimedSplitter (like TimeRotatingFile) the batch is written
+// before a message of another destination (e.g. of the next rotation period).
+//
+// The operation is protected by mutex for thread safety.
+func (l *Logger) SetOutputBatching(output OutType, size int, interval time.Duration) *Logger {
+	return l.changeOutSettings(output, func(c *outContext) {
+		c.batch.limit = max(size, 0)
+		c.batch.interval = max(interval, 0)
+	})
+}
+
+// Returns whether the formatted message (the content of msgbuf) is added to the
+// batch of the output and whether the batch has to be written now. Called by the
+// processing goroutine only.
+func (l *Logger) batchMessage(output OutType, context *outContext, msg *logMessage, probe bool) (batched, flush bool) {
+	l.sync.outsMtx.RLock()
+	limit, interval := context.batch.limit, context.batch.interval
+	l.sync.outsMtx.RUnlock()
+	b := &context.batch
+	if limit <= 0 && b.buf.Len() == 0 {
+		return false, false
+	}
+	if b.buf.Len() == 0 && interval > 0 {
+		b.due = time.Now().Add(interval)
+	}
+	b.buf.Write(l.msgbuf.Bytes())
+	l.msgbuf.Reset()
+	b.msgs = append(b.msgs, logMessage{pushed: msg.pushed, msgclnt: msg.msgclnt, msgtype: msg.msgtype, annex: msg.annex})
+	flush = probe || limit <= 0 || b.buf.Len() >= limit || LogLevel(msg.annex) >= _BATCH_FLUSH_LEVEL
+	if !flush {
+		l.trackBatch(output, context)
+	}
+	return true, flush
+}
+
+// Returns whether the message goes to another destination of the TimedSplitter
+// output than the pending batch (so the batch has to be written first).
+func batchSplits(output OutType, context *outContext, msg *logMessage) bool {
+	ts, ok := output.(TimedSplitter)
+	b := &context.batch
+	return ok && len(b.msgs) > 0 && !ts.SameDestination(b.msgs[0].pushed, msg.pushed)
+}
+
+// Writes the pending batch of the output (or queues it for async outputs) and
+// clears it even on panic. Returns the write error.
+func (l *Logger) writeBatch(output OutType, context *outContext, probe bool) (err error) {
+	b := &context.batch
+	defer func() {
+		b.buf.Reset()
+		clear(b.msgs)
+		b.msgs = b.msgs[:0]
+		b.due = time.Time{}
+	}()
+	if b.buf.Len() == 0 {
+		return nil
+	}
+	if aw := l.asyncs[output]; aw != nil {
+		l.pushAsync(aw, asyncItem{
+			batch: append([]logMessage(nil), b.msgs...),
+			data:  bytes.Clone(b.buf.Bytes()),
+			probe: probe,
+		})
+		return nil
+	}
+	n, e := l.writeOutput(output, context, &b.buf, b.msgs[0].pushed)
+	if e != nil {
+		return newWriteError(n, e)
+	}
+	l.countBatchWritten(context, b.msgs, n)
+	return nil
+}
+
+// Registers the output with a pending batch for flushing in time (the processing
+// goroutine wakes up at the earliest deadline).
+func (l *Logger) trackBatch(output OutType, context *outContext) {
+	if l.batched == nil {
+		l.batched = map[OutType]*outContext{}
+	}
+	l.batched[output] = context
+	if due := context.batch.due; !due.IsZero() && (l.batchDue.IsZero() || due.Before(l.batchDue)) {
+		l.batchDue = due
+		if l.batchTimer == nil {
+			l.batchTimer = time.NewTimer(time.Until(due))
+		} else {
+			l.batchTimer.Reset(time.Until(due))
+		}
+	}
+}
+
+// Returns the channel of the batch flush timer (nil if no deadline is pending).
+func (l *Logger) batchTimerChan() <-chan time.Time {
+	if l.batchDue.IsZero() {
+		return nil
+	}
+	return l.batchTimer.C
+}
+
+// Writes pending batches (all of them if force is true or the due ones otherwise)
+// and reschedules the flush timer. Batches of removed outputs are written as well.
+// Called by the processing goroutine only (with the processing lock held).
+func (l *Logger) flushBatches(force bool) {
+	now := time.Now()
+	l.batchDue = time.Time{}
+	for output, context := range l.batched {
+		due := context.batch.due
+		if context.batch.buf.Len() > 0 && !force && (due.IsZero() || now.Before(due)) {
+			if !due.IsZero() && (l.batchDue.IsZero() || due.Before(l.batchDue)) {
+				l.batchDue = due
+			}
+			continue
+		}
+		delete(l.batched, output)
+		if context.batch.buf.Len() > 0 {
+			panicked, err := l.flushBatch(output, context)
+			l.outputWritten(output, context, false, panicked, err)
+		}
+	}
+	if !l.batchDue.IsZero() {
+		l.batchTimer.Reset(time.Until(l.batchDue))
+	}
+}
+
+// Writes the pending batch of the output converting a panic into an error.
+func (l *Logger) flushBatch(output OutType, context *outContext) (panicked bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			panicked = true
+			err = errors.New("panic writing log to output" + panicDesc(r))
+		}
+	}()
+	return false, l.writeBatch(output, context, false)
+}
@@ -0,0 +1,129 @@
+package lgr
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// CountWriter counts write calls.
+type CountWriter struct {
+	FakeWriter
+	writes int
+}
+
+func (c *CountWriter) Write(b []byte) (int, error) {
+	c.writes++
+	return c.FakeWriter.Write(b)
+}
+
+func Test_Logger_SetOutputBatching(t *testing.T) {
+	out := &CountWriter{}
+	l := InitWithParams(LVL_UNKNOWN, &FakeWriter{}, out)
+	l.msgbuf = bytes.NewBuffer(make([]byte, DEFAULT_OUT_BUFF))
+	l.SetOutputBatching(out, 10, -time.Second)
+	assert.Equal(t, 10, l.outputs[out].batch.limit)
+	assert.Zero(t, l.outputs[out].batch.interval)
+	msg := &logMessage{msgtype: _MSG_LOG_TEXT, msgdata: []byte("a"), annex: basetype(LVL_INFO)}
+
+	for range 4 {
+		l.logTextToOutputs(msg)
+	}
+	assert.Zero(t, out.writes, "batch is written before the size limit")
+	l.logTextToOutputs(msg)
+	assert.Equal(t, 1, out.writes)
+	assert.Equal(t, strings.Repeat("a\n", 5), out.String())
+	s := l.Stats().Outputs[0]
+	assert.Equal(t, uint64(5), s.Written[LVL_INFO])
+	assert.Equal(t, uint64(10), s.Bytes)
+
+	t.Run("error_level", func(t *testing.T) {
+		out.Clear()
+		l.logTextToOutputs(msg)
+		l.logTextToOutputs(&logMessage{msgtype: _MSG_LOG_TEXT, msgdata: []byte("e"), annex: basetype(LVL_ERROR)})
+		assert.Equal(t, 2, out.writes)
+		assert.Equal(t, "a\ne\n", out.String())
+	})
+	t.Run("switch_off", func(t *testing.T) {
+		out.Clear()
+		l.logTextToOutputs(msg)
+		l.SetOutputBatching(out, 0, 0)
+		msg.msgdata = []byte("b")
+		l.logTextToOutputs(msg)
+		assert.Equal(t, "a\nb\n", out.String(), "pending batch is lost")
+		l.logTextToOutputs(msg)
+		assert.Equal(t, 4, out.writes, "message is batched after switching off")
+	})
+	t.Run("removed", func(t *testing.T) {
+		out.Clear()
+		l.SetOutputBatching(out, 10, 0)
+		l.logTextToOutputs(msg)
+		l.RemoveOutputs(out)
+		l.flushBatches(true)
+		assert.Equal(t, "b\n", out.String(), "batch of removed output is lost")
+	})
+}
+
+func Test_Logger_Batching_Running(t *testing.T) {
+	t.Run("interval", func(t *testing.T) {
+		out := NewGateWriter()
+		out.Open()
+		l := InitWithParams(LVL_UNKNOWN, &FakeWriter{}, out)
+		l.SetOutputBatching(out, 1<<20, 5*time.Millisecond)
+		lc := l.NewClient("")
+		l.Start(4)
+		lc.LogInfo("a")
+		assert.Eventually(t, func() bool { return out.String() == ":a\n" }, time.Second, time.Millisecond, "batch is not flushed in time")
+		lc.LogInfo("b")
+		assert.Eventually(t, func() bool { return out.String() == ":a\n:b\n" }, time.Second, time.Millisecond, "timer is not rescheduled")
+		l.StopAndWait()
+	})
+	t.Run("stop", func(t *testing.T) {
+		out := &CountWriter{}
+		l := InitWithParams(LVL_UNKNOWN, &FakeWriter{}, out)
+		l.SetOutputBatching(out, 1<<20, 0)
+		lc := l.NewClient("")
+		l.Start(4)
+		for _, s := range []string{"a", "b", "c"} {
+			lc.LogInfo(s)
+		}
+		l.StopAndWait()
+		assert.Equal(t, ":a\n:b\n:c\n", out.String())
+		assert.Equal(t, 1, out.writes)
+	})
+	t.Run("async", func(t *testing.T) {
+		out := &CountWriter{}
+		l := InitWithParams(LVL_UNKNOWN, &FakeWriter{}, out)
+		l.SetOutputBatching(out, 8, 0).SetOutputAsync(out, 4)
+		lc := l.NewClient("")
+		l.Start(4)
+		for range 6 {
+			lc.LogInfo("x")
+		}
+		l.StopAndWait()
+		assert.Equal(t, strings.Repeat(":x\n", 6), out.String())
+		assert.Equal(t, 2, out.writes)
+		assert.Equal(t, uint64(6), l.Stats().Outputs[0].Written[LVL_INFO])
+	})
+}
+
+func Test_Logger_Batching_Panic(t *testing.T) {
+	out := &PanicWriter{}
+	l := InitWithParams(LVL_UNKNOWN, &FakeWriter{}, out)
+	l.msgbuf = bytes.NewBuffer(make([]byte, DEFAULT_OUT_BUFF))
+	l.SetOutputBatching(out, 1<<20, 0)
+	msg := &logMessage{msgtype: _MSG_LOG_TEXT, msgdata: []byte("a"), annex: basetype(LVL_INFO)}
+	l.logTextToOutputs(msg)
+	l.logTextToOutputs(msg)
+	assert.True(t, l.IsOutputEnabled(out))
+	l.flushBatches(true)
+	assert.False(t, l.IsOutputEnabled(out), "output is not disabled on batch panic")
+	s := l.Stats().Outputs[0]
+	assert.Equal(t, uint64(1), s.Panics)
+	assert.Zero(t, s.Written.Total())
+	assert.Zero(t, l.outputs[out].batch.buf.Len(), "batch is not cleared")
+	assert.Empty(t, l.batched)
+}
@@ -23,18 +23,49 @@ import (
 	"bytes"
 	"io"
 	"sync"
+	"sync/atomic"
 	"time"
+	"weak"
 )
 
 type basetype byte // basetype is the underlying byte-sized representation used for enums
 
-type LogLevel basetype // Logger levels  (alias for byte)
-type lgrState basetype
+type LogLevel basetype    // Logger levels  (alias for byte)
+type LoggerState basetype // Logger lifecycle state (see Logger.State)
 type msgType basetype
 type cmdType basetype
 
 type OutType io.Writer // Logger outputs (alias for io.Writer)
 
+// TimedWriter is an optional interface for outputs that depend on the log message
+// time (e.g. time-based file rotation). If an output implements it, the logger calls
+// WriteTimed instead of Write and passes the time the message was queued.
+type TimedWriter interface {
+	WriteTimed(p []byte, t time.Time) (n int, err error)
+}
+
+// TimedSplitter is an optional interface for TimedWriter outputs writing messages
+// of different times to different destinations (e.g. files of rotation periods).
+// Batches of such outputs never mix messages of different destinations (see
+// Logger.SetOutputBatching).
+type TimedSplitter interface {
+	// Reports whether messages queued at times a and b go to the same destination.
+	SameDestination(a, b time.Time) bool
+}
+
+// Reopener is an optional interface for outputs that can close and reopen their
+// underlying resource (e.g. a file moved away by external log rotation). See
+// Logger.ReopenOutputs.
+type Reopener interface {
+	Reopen() error
+}
+
+// Syncer is an optional interface for outputs that can commit written data to the
+// storage (like [os.File]). See Logger.Flush.
+type Syncer interface {
+	Sync() error
+}
+
 // outList maps output writers to their per-output context (settings).
 type outList map[OutType]*outContext
 
@@ -45,6 +76,10 @@ type logMessage struct {
 	pushed  time.Time  // timestamp when message was queued
 	msgclnt *LogClient // originating client (may be nil for some internal messages)
 	msgdata []byte     // payload (text or command data)
+	fields  []Field    // structured key/value data attached to text messages
+	args    []any      // arguments of deferred formatting (msgdata is the format, see Logf_deferred)
+	done    chan error // barrier commands only: receives the result (see Logger.Flush)
+	protect bool       // never dropped on overflow (set when queued, see sendMessage)
 	msgtype msgType    // message type enum
 	annex   basetype   // extra byte-sized value (level or command id)
 }
@@ -62,12 +97,45 @@ type Logger struct {
 		procMtx sync.RWMutex   // guards message processing (read lock used during procced)
 		waitEnd sync.WaitGroup // tracks background goroutine lifecycle
 	}
-	outputs outList // map of outputs and per-output contexts
-	fallbck OutType // fallback writer used to report internal errors
-	channel chan logMessage
-	msgbuf  *bytes.Buffer // buffer reused while building formatted output
-	state   lgrState
-	level   LogLevel // global minimal level for the logger
+	outputs     outList // map of outputs and per-output contexts
+	fallbck     OutType // fallback writer used to report internal errors
+	channel     chan logMessage
+	procEnd     chan struct{}             // closed when the processing goroutine exits
+	procDrained chan struct{}             // closed when the processing goroutine has written its queue
+	procNext    chan struct{}             // closed when the next processing goroutine is started
+	msgbuf      *bytes.Buffer             // buffer reused while building formatted output
+	clients     []weak.Pointer[LogClient] // registered clients (for statistics)
+	outseq      int                       // number of added outputs (for default names)
+	outstate    OutputStateHandler        // output state change handler (see SetOutputStateHandler)
+	lifecycle   LifecycleHandler          // lifecycle transitions handler (see SetLifecycleHandler)
+	asyncs      map[OutType]*asyncWriter  // async output writers (owned by the processing goroutine)
+	asyncPrev   map[OutType]chan struct{} // done of stopped writers possibly still running (the same)
+	batched     map[OutType]*outContext   // outputs with pending batches (owned by the processing goroutine)
+	batchDue    time.Time                 // the earliest batch flush deadline (zero if none)
+	batchTimer  *time.Timer               // batch flush timer
+	state       LoggerState
+	level       LogLevel // global minimal level for the logger
+	stats       struct { // message counters and processing latency (see Stats)
+		msgs    msgCounters
+		latency latencyCounters
+	}
+	abandon   atomic.Bool   // messages are abandoned after the shutdown deadline (see Shutdown)
+	abandoned atomic.Uint64 // total number of abandoned messages
+	// queue overflow handling (see SetOverflowPolicy)
+	overflow struct {
+		policy     OverflowPolicy
+		timeout    time.Duration // max wait time for OVERFLOW_BLOCK_TIMEOUT
+		guaranteed LogLevel      // min level of messages never dropped
+		shedlevel  LogLevel      // messages below the level are dropped first
+		reserve    int           // percent of the queue reserved for guaranteed messages
+		dropped    atomic.Uint64 // total number of dropped messages
+		unreported atomic.Uint64 // dropped messages since the last notice
+		protected  atomic.Int64  // protected messages in the queue (may lag behind)
+		evictMtx   sync.Mutex    // guards eviction of the oldest message and rescued
+		rescued    []logMessage  // protected messages evicted by a race (see evictOldest)
+		waiters    atomic.Int32  // callers waiting for room (OVERFLOW_BLOCK_TIMEOUT)
+		room       chan struct{} // signalled by the processing goroutine when waiters > 0
+	}
 }
 
 // LogClient represents a producer of log messages. Each client carries its own
@@ -80,6 +148,7 @@ type LogClient struct {
 	minLevel LogLevel // per-client minimal level to accept
 	curLevel LogLevel // current level used by Write / fmt.Fprintf helpers
 	enabled  bool     // whether the client may submit messages
+	stats    msgCounters
 }
 
 // LevelMap is a fixed-size array with one entry per log level. Used for
@@ -88,13 +157,23 @@ type LevelMap [_LVL_MAX_for_checks_only]string
 
 // outContext holds formatting and filtering options for a specific output.
 type outContext struct {
-	colormap  *LevelMap // logLevel-associated ANSI terminal color fragments
-	prefixmap *LevelMap // per-level textual prefix
-	delimiter []byte    // separator after prefix/client name (usually ":")
-	timefmt   string    // time.Format string; if empty, no timestamp is written
-	showlvlid bool      // whether to include numeric level id like "[3]"
-	enabled   bool      // whether this output is enabled for writing
-	minlevel  LogLevel  // minimal level accepted by this output
+	name      string     // output name for statistics and metrics
+	colormap  *LevelMap  // logLevel-associated ANSI terminal color fragments
+	prefixmap *LevelMap  // per-level textual prefix
+	delimiter []byte     // separator after prefix/client name (usually ":")
+	fieldsep  []byte     // separator before each structured field (usually " ")
+	fieldasg  []byte     // separator between field key and value (usually "=")
+	timefmt   string     // time.Format string; if empty, no timestamp is written
+	timedlm   []byte     // separator after timestamp in text format
+	showlvlid bool       // whether to include numeric level id like "[3]"
+	formatter Formatter  // message formatter (nil for default text format)
+	enabled   bool       // whether this output is enabled for writing
+	minlevel  LogLevel   // minimal level accepted by this output
+	retry     outRetry   // re-enabling policy after write panics (see SetOutputRetry)
+	asyncsize int        // async queue size (zero for sync writes, see SetOutputAsync)
+	timeout   outTimeout // write timeout settings and state (see SetOutputWriteTimeout)
+	batch     outBatch   // batching settings and pending batch (see SetOutputBatching)
+	stats     outCounters
 }
 
 /////////////////////////////////////////////////////////////////////////////////////////
@@ -120,6 +199,10 @@ const (
 	DEFAULT_OUT_BUFF   = 256 // initial buffer size for log output text
 	DEFAULT_DELIMITER  = ":" // default delimiter between log fields (except time)
 	DEFAULT_FATAL_NAME = "EXIT(1)"
+	// Default values for structured fields rendering
+	DEFAULT_FIELD_SEP    = " "     // default separator before each structured field
+	DEFAULT_FIELD_ASSIGN = "="     // default separator between field key and value
+	DEFAULT_ERROR_KEY    = "error" // key used by Err() fields
 )
 
 const (
@@ -133,10 +216,10 @@ const (
 
 const (
 	// Logger lifecycle states.
-	_STATE_UNKNOWN lgrState = iota
-	_STATE_ACTIVE
-	_STATE_STOPPING
-	_STATE_STOPPED
+	STATE_UNKNOWN LoggerState = iota
+	STATE_ACTIVE
+	STATE_STOPPING
+	STATE_STOPPED
 	_STATE_MAX_for_checks_only
 )
 
@@ -155,7 +238,9 @@ const (
 	_CMD_CLIENT_DUMMY, _CMD_CLIENT_commands_min
 	_CMD_CLIENT_SET_LEVEL, _
 	_CMD_CLIENT_SET_NAME, _CMD_CLIENT_commands_max
-	_CMD_PING_FALLBACK, _CMD_MAX_for_checks_only
+	_CMD_PING_FALLBACK, _
+	_CMD_OUTPUTS_REOPEN, _
+	_CMD_OUTPUTS_FLUSH, _CMD_MAX_for_checks_only
 )
 
 /////////////////////////////////////////////////////////////////////////////////////////
@@ -205,9 +290,9 @@ func norm_byte[T ~byte](val, overlimit, def T) T {
 	}
 }
 
-// Ensures a provided lgrState is within the valid range
-func normState(state lgrState) lgrState {
-	return norm_byte(state, _STATE_MAX_for_checks_only, _STATE_UNKNOWN)
+// Ensures a provided LoggerState is within the valid range
+func normState(state LoggerState) LoggerState {
+	return norm_byte(state, _STATE_MAX_for_checks_only, STATE_UNKNOWN)
 }
 
 // Ensures a provided LogLevel is within the valid range
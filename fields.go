@@ -0,0 +1,180 @@
+package lgr
+
+/*
+Structured key/value fields attached to log messages.
+
+Fields are created in the caller goroutine by typed constructors (Str, Int,
+Bool, ...) and travel through the queue together with the message text. They
+are rendered to bytes only by the processing goroutine according to the
+settings of each output, so different outputs can render the same fields in
+different ways.
+
+Example:
+
+	client.LogInfo("login", lgr.Str("user", u), lgr.Int("attempt", n))
+*/
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+type fieldKind basetype
+
+const (
+	// Field value kinds (define which part of Field holds the value).
+	_FLD_STRING fieldKind = iota
+	_FLD_INT
+	_FLD_UINT
+	_FLD_FLOAT
+	_FLD_BOOL
+	_FLD_DURATION
+	_FLD_TIME
+	_FLD_MAX_for_checks_only
+)
+
+// Field is a typed key/value pair attached to a log message. The value is
+// immutable after creation, so fields can be safely shared between goroutines.
+type Field struct {
+	key  string
+	kind fieldKind
+	num  uint64 // integer, bool, duration and float (as bits) values
+	str  string // string values (including error texts)
+	obj  any    // non-scalar values (time.Time)
+}
+
+// Str creates a field with a string value.
+func Str(key, value string) Field {
+	return Field{key: key, kind: _FLD_STRING, str: value}
+}
+
+// Int creates a field with an int value.
+func Int(key string, value int) Field {
+	return Int64(key, int64(value))
+}
+
+// Int64 creates a field with an int64 value.
+func Int64(key string, value int64) Field {
+	return Field{key: key, kind: _FLD_INT, num: uint64(value)}
+}
+
+// Uint64 creates a field with an uint64 value.
+func Uint64(key string, value uint64) Field {
+	return Field{key: key, kind: _FLD_UINT, num: value}
+}
+
+// Float64 creates a field with a float64 value.
+func Float64(key string, value float64) Field {
+	return Field{key: key, kind: _FLD_FLOAT, num: math.Float64bits(value)}
+}
+
+// Bool creates a field with a bool value.
+func Bool(key string, value bool) Field {
+	f := Field{key: key, kind: _FLD_BOOL}
+	if value {
+		f.num = 1
+	}
+	return f
+}
+
+// Duration creates a field with a time.Duration value (rendered like "1.5s").
+func Duration(key string, value time.Duration) Field {
+	return Field{key: key, kind: _FLD_DURATION, num: uint64(value)}
+}
+
+// Time creates a field with a time.Time value (rendered in RFC3339 format
+// with nanoseconds).
+func Time(key string, value time.Time) Field {
+	return Field{key: key, kind: _FLD_TIME, obj: value}
+}
+
+// Err creates a field with key "error" and the error text as value ("<nil>"
+// for nil error).
+func Err(e error) Field {
+	if e == nil {
+		return Str(DEFAULT_ERROR_KEY, "<nil>")
+	}
+	return Str(DEFAULT_ERROR_KEY, e.Error())
+}
+
+// Any creates a field with a value of the most suitable kind. Values of unknown
+// types are converted to a string immediately (in the caller goroutine) so the
+// field never refers to mutable caller data.
+func Any(key string, value any) Field {
+	switch v := value.(type) {
+	case string:
+		return Str(key, v)
+	case int:
+		return Int(key, v)
+	case int8:
+		return Int64(key, int64(v))
+	case int16:
+		return Int64(key, int64(v))
+	case int32:
+		return Int64(key, int64(v))
+	case int64:
+		return Int64(key, v)
+	case uint:
+		return Uint64(key, uint64(v))
+	case uint8:
+		return Uint64(key, uint64(v))
+	case uint16:
+		return Uint64(key, uint64(v))
+	case uint32:
+		return Uint64(key, uint64(v))
+	case uint64:
+		return Uint64(key, v)
+	case float32:
+		return Float64(key, float64(v))
+	case float64:
+		return Float64(key, v)
+	case bool:
+		return Bool(key, v)
+	case time.Duration:
+		return Duration(key, v)
+	case time.Time:
+		return Time(key, v)
+	case error:
+		return Str(key, v.Error())
+	case fmt.Stringer:
+		return Str(key, v.String())
+	default:
+		return Str(key, fmt.Sprint(v))
+	}
+}
+
+// Returns the field key.
+func (f Field) Key() string {
+	return f.key
+}
+
+// Returns the field value as text (the same representation used by the
+// default text output format).
+func (f Field) String() string {
+	return string(appendFieldValue(nil, &f))
+}
+
+// Appends the textual representation of the field value to dst.
+func appendFieldValue(dst []byte, f *Field) []byte {
+	switch f.kind {
+	case _FLD_STRING:
+		dst = append(dst, f.str...)
+	case _FLD_INT:
+		dst = strconv.AppendInt(dst, int64(f.num), 10)
+	case _FLD_UINT:
+		dst = strconv.AppendUint(dst, f.num, 10)
+	case _FLD_FLOAT:
+		dst = strconv.AppendFloat(dst, math.Float64frombits(f.num), 'g', -1, 64)
+	case _FLD_BOOL:
+		dst = strconv.AppendBool(dst, f.num != 0)
+	case _FLD_DURATION:
+		dst = append(dst, time.Duration(f.num).String()...)
+	case _FLD_TIME:
+		if t, ok := f.obj.(time.Time); ok {
+			dst = t.AppendFormat(dst, time.RFC3339Nano)
+		}
+	}
+	return dst
+}
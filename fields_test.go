@@ -0,0 +1,116 @@
+package lgr
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testStringer struct{}
+
+func (testStringer) String() string { return "stringer" }
+
+func Test_Field_String(t *testing.T) {
+	ti := time.Date(2024, 2, 29, 23, 59, 58, 123, time.UTC)
+	tests := []struct {
+		name  string
+		field Field
+		key   string
+		want  string
+	}{
+		{"str", Str("k", testlogstr), "k", testlogstr},
+		{"str_empty", Str("", ""), "", ""},
+		{"int", Int("i", -42), "i", "-42"},
+		{"int64_min", Int64("i", math.MinInt64), "i", "-9223372036854775808"},
+		{"uint64_max", Uint64("u", math.MaxUint64), "u", "18446744073709551615"},
+		{"float", Float64("f", 1.5), "f", "1.5"},
+		{"float_inf", Float64("f", math.Inf(-1)), "f", "-Inf"},
+		{"bool_true", Bool("b", true), "b", "true"},
+		{"bool_false", Bool("b", false), "b", "false"},
+		{"duration", Duration("d", 1500*time.Millisecond), "d", "1.5s"},
+		{"time", Time("t", ti), "t", "2024-02-29T23:59:58.000000123Z"},
+		{"err", Err(errors.New(errorStr)), DEFAULT_ERROR_KEY, errorStr},
+		{"err_nil", Err(nil), DEFAULT_ERROR_KEY, "<nil>"},
+		{"any_int8", Any("a", int8(-8)), "a", "-8"},
+		{"any_uint16", Any("a", uint16(16)), "a", "16"},
+		{"any_float32", Any("a", float32(0.5)), "a", "0.5"},
+		{"any_duration", Any("a", time.Second), "a", "1s"},
+		{"any_time", Any("a", ti), "a", "2024-02-29T23:59:58.000000123Z"},
+		{"any_error", Any("a", errors.New(errorStr)), "a", errorStr},
+		{"any_stringer", Any("a", testStringer{}), "a", "stringer"},
+		{"any_slice", Any("a", []int{1, 2}), "a", "[1 2]"},
+		{"any_nil", Any("a", nil), "a", "<nil>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.key, tt.field.Key(), "wrong key")
+			assert.Equal(t, tt.want, tt.field.String(), "wrong value")
+		})
+	}
+	t.Run("any_kinds", func(t *testing.T) {
+		assert.Equal(t, _FLD_INT, Any("", 1).kind)
+		assert.Equal(t, _FLD_UINT, Any("", uint(1)).kind)
+		assert.Equal(t, _FLD_BOOL, Any("", true).kind)
+		assert.Equal(t, _FLD_FLOAT, Any("", 1.0).kind)
+		assert.Equal(t, _FLD_STRING, Any("", struct{}{}).kind)
+	})
+}
+
+func Test_Logger_buildTextMessage_fields(t *testing.T) {
+	outBuffer := bytes.NewBuffer(make([]byte, DEFAULT_OUT_BUFF))
+	msg := &logMessage{
+		msgdata: []byte("msg"),
+		fields:  []Field{Str("user", "bob"), Int("attempt", 3)},
+		annex:   basetype(LVL_INFO),
+	}
+	tests := []struct {
+		name    string
+		context *outContext
+		want    string
+	}{
+		{"nil_context", nil, "msg user=bob attempt=3\n"},
+		{"custom", &outContext{fieldsep: []byte(" | "), fieldasg: []byte(": ")}, "msg | user: bob | attempt: 3\n"},
+		{"colors",
+			&outContext{colormap: LevelColorOnBlackMap, fieldsep: []byte(" "), fieldasg: []byte("=")},
+			ANSI_COL_PRFX + LevelColorOnBlackMap[LVL_INFO] + ANSI_COL_SUFX + "msg user=bob attempt=3" + ANSI_COL_RESET + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, buildTextMessage(outBuffer, msg, tt.context).String())
+		})
+	}
+}
+
+func Test_LogClient_LogWithFields(t *testing.T) {
+	out1 := &FakeWriter{}
+	out2 := &FakeWriter{}
+	ferr := &FakeWriter{}
+	l := InitWithParams(LVL_UNKNOWN, ferr, out1, out2)
+	l.SetOutputFieldFormat(out2, ";", ":")
+	lc := l.NewClient("db")
+	l.Start(0)
+	fields := []Field{Str("user", "u42"), Int("attempt", 2)}
+	lc.LogInfo("login", fields...)
+	fields[0] = Str("user", "changed") // must not affect queued message
+	lc.LogErr(errors.New("failed"), Err(errors.New("timeout")))
+	lc.LogWarn("plain")
+	l.StopAndWait()
+	assert.Equal(t, "db:login user=u42 attempt=2\ndb:failed error=timeout\ndb:plain\n", out1.String())
+	assert.Equal(t, "db:login;user:u42;attempt:2\ndb:failed;error:timeout\ndb:plain\n", out2.String())
+	assert.Empty(t, ferr.buffer)
+}
+
+func Test_Logger_SetOutputFieldFormat(t *testing.T) {
+	out1 := &FakeWriter{}
+	l := Init(out1)
+	assert.Equal(t, DEFAULT_FIELD_SEP, string(l.outputs[out1].fieldsep), "wrong default separator")
+	assert.Equal(t, DEFAULT_FIELD_ASSIGN, string(l.outputs[out1].fieldasg), "wrong default assign")
+	got := l.SetOutputFieldFormat(out1, testlogstr, "")
+	assert.Equal(t, l, got, "wrong return (must be self)")
+	assert.Equal(t, testlogstr, string(l.outputs[out1].fieldsep), "wrong separator assignment")
+	assert.Empty(t, l.outputs[out1].fieldasg, "wrong assign assignment")
+}
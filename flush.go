@@ -0,0 +1,104 @@
+package lgr
+
+/*
+Flush barrier.
+
+Logger.Flush queues a barrier command through the logger channel. When the
+processing goroutine reaches it, every message queued before it is already
+written to sync outputs, so it writes pending batches, schedules the barrier
+for async output writers (behind the messages queued for them, without blocking
+even if an output queue is full) and calls Sync() on outputs implementing
+Syncer. Flush returns once all outputs pass the barrier, while the processing
+goroutine goes on without waiting for async outputs.
+*/
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"syscall"
+)
+
+// Waits until every message queued before the call is written to the outputs and
+// outputs implementing Syncer are synced (e.g. files are committed to the storage).
+// The logger keeps running.
+//
+// Returns the context error if the context is done first (the barrier is processed
+// anyway), the joined errors of Sync calls (also written to the fallback) or the
+// queuing error (e.g. the logger is not active). Queuing may block as usual if
+// the queue is full.
+func (l *Logger) Flush(ctx context.Context) error {
+	msg := makeCmdMessage(nil, _CMD_OUTPUTS_FLUSH, nil)
+	msg.done = make(chan error, 1)
+	if _, err := l.pushMessage(msg); err != nil {
+		return err
+	}
+	select {
+	case err := <-msg.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Writes pending batches, schedules the barrier for async outputs and syncs outputs
+// (called by the processing goroutine only). The result is sent to done (if not nil)
+// once async outputs pass the barrier.
+func (l *Logger) flushOutputs(done chan<- error) {
+	l.flushBatches(true)
+	var (
+		wg     sync.WaitGroup
+		mtx    sync.Mutex
+		errstr string
+	)
+	doSync := func(s Syncer) {
+		if err := syncOutput(s); err != nil {
+			mtx.Lock()
+			defer mtx.Unlock()
+			if len(errstr) > 0 {
+				errstr += "; "
+			}
+			errstr += err.Error()
+		}
+	}
+	for output := range l.outputs {
+		s, ok := output.(Syncer)
+		if aw := l.asyncs[output]; aw != nil {
+			wg.Add(1)
+			aw.after(func() {
+				defer wg.Done()
+				if ok {
+					doSync(s)
+				}
+			})
+		} else if ok {
+			doSync(s)
+		}
+	}
+	go func() {
+		wg.Wait()
+		var err error
+		if len(errstr) > 0 {
+			l.handleLogWriteError(errstr)
+			err = errors.New(errstr)
+		}
+		if done != nil {
+			done <- err
+		}
+	}()
+}
+
+// Calls Sync converting a panic into an error. Errors of outputs that can't be
+// synced (like terminals and pipes) are ignored.
+func syncOutput(s Syncer) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = errors.New("panic syncing output" + panicDesc(p))
+		}
+	}()
+	err = s.Sync()
+	if err == nil || errors.Is(err, syscall.EINVAL) || errors.Is(err, syscall.ENOTSUP) {
+		return nil
+	}
+	return errors.New("error syncing output: " + err.Error())
+}
@@ -0,0 +1,111 @@
+package lgr
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// SyncWriter counts Sync calls and returns the preset error.
+type SyncWriter struct {
+	FakeWriter
+	syncs atomic.Int32
+	err   error
+}
+
+func (s *SyncWriter) Sync() error {
+	s.syncs.Add(1)
+	return s.err
+}
+
+func Test_Logger_Flush(t *testing.T) {
+	slow, batched, synced := NewGateWriter(), &SyncWriter{}, &SyncWriter{}
+	l := InitWithParams(LVL_UNKNOWN, &FakeWriter{}, slow, batched, synced)
+	l.SetOutputAsync(slow, 8).SetOutputBatching(batched, 1<<20, 0)
+	lc := l.NewClient("")
+	assert.ErrorContains(t, l.Flush(context.Background()), _ERROR_MESSAGE_LOGGER_INACTIVE)
+	l.Start(8)
+	defer l.StopAndWait()
+	lc.LogInfo("a")
+	lc.LogInfo("b")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, l.Flush(ctx), context.DeadlineExceeded, "async output is not waited")
+	// sync outputs are flushed before the barrier is passed to the async one
+	assert.Equal(t, int32(1), batched.syncs.Load())
+	assert.Equal(t, int32(1), synced.syncs.Load())
+
+	slow.Open()
+	assert.NoError(t, l.Flush(context.Background()))
+	assert.Equal(t, ":a\n:b\n", slow.String()[:6])
+	assert.Equal(t, ":a\n:b\n", batched.String()[:6], "batch is not written")
+	assert.Equal(t, int32(2), synced.syncs.Load())
+}
+
+func Test_Logger_Flush_Hung(t *testing.T) {
+	hung, healthy := NewGateWriter(), &FakeWriter{}
+	l := InitWithParams(LVL_UNKNOWN, &FakeWriter{}, hung, healthy)
+	l.SetOutputAsync(hung, 1).SetOutputName(healthy, "healthy")
+	lc := l.NewClient("")
+	l.Start(4)
+	for range 4 {
+		lc.LogInfo("x")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, l.Flush(ctx), context.DeadlineExceeded)
+	lc.LogInfo("after")
+	assert.Eventually(t, func() bool {
+		for _, o := range l.Stats().Outputs {
+			if o.Name == "healthy" {
+				return o.Written[LVL_INFO] == 5
+			}
+		}
+		return false
+	}, time.Second, time.Millisecond, "processing goroutine is stalled by the hung output")
+	hung.Open()
+	assert.NoError(t, l.Flush(context.Background()))
+	l.StopAndWait()
+}
+
+func Test_Logger_Flush_Error(t *testing.T) {
+	ferr, bad := &FakeWriter{}, &SyncWriter{err: errors.New("disk is gone")}
+	l := InitWithParams(LVL_UNKNOWN, ferr, bad, &SyncWriter{err: syscall.EINVAL})
+	l.Start(4)
+	err := l.Flush(context.Background())
+	l.StopAndWait()
+	assert.EqualError(t, err, "error syncing output: disk is gone", "unsupported sync is not ignored")
+	assert.Contains(t, ferr.String(), "error syncing output: disk is gone")
+}
+
+func Test_syncOutput(t *testing.T) {
+	assert.NoError(t, syncOutput(&SyncWriter{err: syscall.ENOTSUP}))
+	assert.ErrorContains(t, syncOutput(&SyncWriter{err: errors.New("x")}), "error syncing output: x")
+	var nilsw *SyncWriter
+	assert.ErrorContains(t, syncOutput(nilsw), "panic syncing output")
+}
+
+func Test_Files_Sync(t *testing.T) {
+	dir := t.TempDir()
+	rf, err := NewRotatingFile(filepath.Join(dir, "a.log"), 1<<20, 1)
+	assert.NoError(t, err)
+	trf, err := NewTimeRotatingFile(filepath.Join(dir, "b-2006.log"), ROTATE_DAILY)
+	assert.NoError(t, err)
+	of, err := NewReopenFile(filepath.Join(dir, "c.log"))
+	assert.NoError(t, err)
+	for _, s := range []interface {
+		Syncer
+		Close() error
+	}{rf, trf, of} {
+		assert.NoError(t, s.Sync())
+		assert.NoError(t, s.Close())
+		assert.NoError(t, s.Sync(), "closed file")
+	}
+}
@@ -0,0 +1,357 @@
+package lgr
+
+/*
+Output formats. Every output has a Formatter that builds the bytes written for
+each log record. Built-in formatters are selected by Logger.SetOutputFormat:
+  - FMT_TEXT: prefix/delimiter/ANSI text form (TextFormatter, default)
+  - FMT_JSON: one JSON object per line (JSONFormatter)
+  - FMT_LOGFMT: logfmt line (`ts=... level=INFO client=db msg="..." key=value`,
+    LogfmtFormatter)
+
+Custom formatters are assigned by Logger.SetOutputFormatter.
+
+Like the text form, built-in encoders run in the processing goroutine and use
+only strconv/utf8 helpers (no fmt, no reflection). The processing goroutine uses
+fmt only to format Logf_deferred messages, whose arguments are of basic types
+(see printf.go).
+*/
+
+import (
+	"bytes"
+	"math"
+	"time"
+	"unicode/utf8"
+)
+
+type OutFormat basetype // Built-in output message format (alias for byte)
+
+const (
+	// Built-in output formats.
+	FMT_TEXT   OutFormat = iota // text with optional time, level prefix, colors etc.
+	FMT_JSON                    // JSON object per line
+	FMT_LOGFMT                  // logfmt key=value pairs per line
+	_FMT_MAX_for_checks_only
+)
+
+const (
+	// Keys of the standard message parts in machine-readable formats
+	_KEY_TIME   = "time"
+	_KEY_TS     = "ts" // logfmt time key
+	_KEY_LEVEL  = "level"
+	_KEY_CLIENT = "client"
+	_KEY_MSG    = "msg"
+)
+
+// Formatter builds the representation of a log record for an output. Format is
+// called in the processing goroutine with an empty buffer and has to write the
+// complete record including the line end (if any). The buffer content is written
+// to the output right after Format returns.
+//
+// Panics in Format are handled as output write panics (the output is disabled).
+type Formatter interface {
+	Format(rec Record, buf *bytes.Buffer)
+}
+
+// Record is a read-only view of a queued log message passed to [Formatter]. It
+// also gives access to the settings of the output being formatted. Record is
+// valid only during the Format call.
+type Record struct {
+	msg     *logMessage
+	context *outContext
+}
+
+// Returns the time when the message was queued.
+func (r Record) Time() time.Time {
+	if r.msg == nil {
+		return time.Time{}
+	}
+	return r.msg.pushed
+}
+
+// Returns the message log level.
+func (r Record) Level() LogLevel {
+	if r.msg == nil {
+		return LVL_UNKNOWN
+	}
+	return normLevel(LogLevel(r.msg.annex))
+}
+
+// Returns the name of the client that logged the message (empty for internal
+// messages without client).
+func (r Record) Client() string {
+	if r.msg == nil || r.msg.msgclnt == nil {
+		return ""
+	}
+	return string(r.msg.msgclnt.name)
+}
+
+// Returns the message text.
+func (r Record) Message() string {
+	if r.msg == nil {
+		return ""
+	}
+	return string(r.msg.msgdata)
+}
+
+// Appends the message text to dst (without string conversion) and returns the
+// extended slice.
+func (r Record) AppendMessage(dst []byte) []byte {
+	if r.msg == nil {
+		return dst
+	}
+	return append(dst, r.msg.msgdata...)
+}
+
+// Returns the number of structured fields attached to the message.
+func (r Record) NumFields() int {
+	if r.msg == nil {
+		return 0
+	}
+	return len(r.msg.fields)
+}
+
+// Calls f for each structured field of the message in order until f returns false.
+func (r Record) Fields(f func(Field) bool) {
+	if r.msg == nil {
+		return
+	}
+	for _, field := range r.msg.fields {
+		if !f(field) {
+			return
+		}
+	}
+}
+
+// Returns the time format set for the output (see Logger.SetOutputTimeFormat).
+func (r Record) TimeFormat() string {
+	if r.context == nil {
+		return ""
+	}
+	return r.context.timefmt
+}
+
+// TextFormatter is the default formatter: optional time, level code, level prefix,
+// ANSI colors and client name (according to output settings) followed by message
+// text and fields.
+type TextFormatter struct{}
+
+func (TextFormatter) Format(rec Record, buf *bytes.Buffer) {
+	buildTextMessage(buf, rec.msg, rec.context)
+}
+
+// JSONFormatter writes every record as one JSON object per line.
+type JSONFormatter struct{}
+
+func (JSONFormatter) Format(rec Record, buf *bytes.Buffer) {
+	buildJSONMessage(buf, rec.msg)
+}
+
+// LogfmtFormatter writes every record as a logfmt line using the output time format.
+type LogfmtFormatter struct{}
+
+func (LogfmtFormatter) Format(rec Record, buf *bytes.Buffer) {
+	buildLogfmtMessage(buf, rec.msg, rec.TimeFormat())
+}
+
+// Returns the built-in formatter for the format ([TextFormatter] for unknown ones).
+func formatterOf(format OutFormat) Formatter {
+	switch format {
+	case FMT_JSON:
+		return JSONFormatter{}
+	case FMT_LOGFMT:
+		return LogfmtFormatter{}
+	}
+	return TextFormatter{}
+}
+
+// Builds the representation of a message with the output formatter (text format
+// is used if there is no context or formatter).
+func buildMessage(outBuffer *bytes.Buffer, msg *logMessage, context *outContext) *bytes.Buffer {
+	if context == nil || context.formatter == nil {
+		return buildTextMessage(outBuffer, msg, context)
+	}
+	outBuffer.Reset()
+	context.formatter.Format(Record{msg: msg, context: context}, outBuffer)
+	return outBuffer
+}
+
+// Constructs a single-line JSON object for a message:
+//
+//	{"time":"<RFC3339Nano>","level":"INFO","client":"db","msg":"text","key":"value",...}
+//
+// Client is omitted for messages without client. Field keys are written as is,
+// so they can duplicate the standard keys.
+func buildJSONMessage(outBuffer *bytes.Buffer, msg *logMessage) *bytes.Buffer {
+	outBuffer.Reset()
+	if msg != nil {
+		b := outBuffer.AvailableBuffer()
+		b = append(b, `{"`+_KEY_TIME+`":"`...)
+		b = msg.pushed.AppendFormat(b, time.RFC3339Nano)
+		b = append(b, `","`+_KEY_LEVEL+`":"`...)
+		b = append(b, LevelFullNames[normLevel(LogLevel(msg.annex))]...)
+		b = append(b, '"')
+		if msg.msgclnt != nil {
+			b = append(b, `,"`+_KEY_CLIENT+`":`...)
+			b = appendJSONString(b, msg.msgclnt.name)
+		}
+		b = append(b, `,"`+_KEY_MSG+`":`...)
+		b = appendJSONString(b, msg.msgdata)
+		for i := range msg.fields {
+			b = append(b, ',')
+			b = appendJSONString(b, msg.fields[i].key)
+			b = append(b, ':')
+			b = appendJSONValue(b, &msg.fields[i])
+		}
+		b = append(b, '}', '\n')
+		outBuffer.Write(b)
+	}
+	return outBuffer
+}
+
+// Constructs a logfmt line for a message:
+//
+//	ts=<time> level=INFO client=db msg="text with spaces" key=value ...
+//
+// Time is formatted with timefmt (RFC3339 with nanoseconds if empty). Values are
+// quoted and escaped when necessary, invalid characters in keys are replaced with
+// '_'. Client is omitted for messages without client.
+func buildLogfmtMessage(outBuffer *bytes.Buffer, msg *logMessage, timefmt string) *bytes.Buffer {
+	outBuffer.Reset()
+	if msg != nil {
+		if len(timefmt) == 0 {
+			timefmt = time.RFC3339Nano
+		}
+		b := outBuffer.AvailableBuffer()
+		b = append(b, _KEY_TS+"="...)
+		b = appendLogfmtValue(b, msg.pushed.AppendFormat(nil, timefmt))
+		b = append(b, " "+_KEY_LEVEL+"="...)
+		b = append(b, LevelFullNames[normLevel(LogLevel(msg.annex))]...)
+		if msg.msgclnt != nil {
+			b = append(b, " "+_KEY_CLIENT+"="...)
+			b = appendLogfmtValue(b, msg.msgclnt.name)
+		}
+		b = append(b, " "+_KEY_MSG+"="...)
+		b = appendLogfmtValue(b, msg.msgdata)
+		for i := range msg.fields {
+			b = append(b, ' ')
+			b = appendLogfmtKey(b, msg.fields[i].key)
+			b = append(b, '=')
+			if msg.fields[i].kind == _FLD_STRING {
+				b = appendLogfmtValue(b, msg.fields[i].str)
+			} else {
+				b = appendLogfmtValue(b, appendFieldValue(nil, &msg.fields[i]))
+			}
+		}
+		b = append(b, '\n')
+		outBuffer.Write(b)
+	}
+	return outBuffer
+}
+
+// Appends a logfmt key replacing characters not allowed in keys (spaces, controls,
+// '=' and '"') with '_'. Empty key is written as "_".
+func appendLogfmtKey(dst []byte, key string) []byte {
+	if len(key) == 0 {
+		return append(dst, '_')
+	}
+	for i := 0; i < len(key); i++ {
+		if c := key[i]; c <= ' ' || c == '=' || c == '"' || c == 0x7f {
+			dst = append(dst, '_')
+		} else {
+			dst = append(dst, c)
+		}
+	}
+	return dst
+}
+
+// Appends a logfmt value, quoted and escaped if it is empty or contains spaces,
+// controls, '=', '"', '\' or invalid UTF-8.
+func appendLogfmtValue[T ~string | ~[]byte](dst []byte, s T) []byte {
+	if logfmtNeedsQuotes(s) {
+		return appendJSONString(dst, s)
+	}
+	return append(dst, s...)
+}
+
+// Checks whether a logfmt value must be quoted.
+func logfmtNeedsQuotes[T ~string | ~[]byte](s T) bool {
+	if len(s) == 0 {
+		return true
+	}
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			if c <= ' ' || c == '=' || c == '"' || c == '\\' || c == 0x7f {
+				return true
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(string(s[i:min(i+utf8.UTFMax, len(s))]))
+		if r == utf8.RuneError && size == 1 {
+			return true
+		}
+		i += size
+	}
+	return false
+}
+
+// Appends a field value as JSON: numbers and bools as is, everything else (and
+// non-finite floats) as strings.
+func appendJSONValue(dst []byte, f *Field) []byte {
+	switch f.kind {
+	case _FLD_INT, _FLD_UINT, _FLD_BOOL:
+		return appendFieldValue(dst, f)
+	case _FLD_FLOAT:
+		if v := math.Float64frombits(f.num); !math.IsInf(v, 0) && !math.IsNaN(v) {
+			return appendFieldValue(dst, f)
+		}
+	case _FLD_STRING:
+		return appendJSONString(dst, f.str)
+	}
+	return appendJSONString(dst, appendFieldValue(nil, f))
+}
+
+// Appends s as a double-quoted JSON string.
+func appendJSONString[T ~string | ~[]byte](dst []byte, s T) []byte {
+	dst = append(dst, '"')
+	dst = appendEscaped(dst, s)
+	return append(dst, '"')
+}
+
+const _HEX_DIGITS = "0123456789abcdef"
+
+// Appends s with JSON-compatible escapes: quotes, backslashes and control
+// characters are escaped, invalid UTF-8 sequences are replaced with U+FFFD.
+func appendEscaped[T ~string | ~[]byte](dst []byte, s T) []byte {
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				dst = append(dst, '\\', c)
+			case c == '\n':
+				dst = append(dst, '\\', 'n')
+			case c == '\r':
+				dst = append(dst, '\\', 'r')
+			case c == '\t':
+				dst = append(dst, '\\', 't')
+			case c < 0x20 || c == 0x7f:
+				dst = append(dst, '\\', 'u', '0', '0', _HEX_DIGITS[c>>4], _HEX_DIGITS[c&0xF])
+			default:
+				dst = append(dst, c)
+			}
+			i++
+			continue
+		}
+		// short temporary string conversion does not allocate
+		r, size := utf8.DecodeRuneInString(string(s[i:min(i+utf8.UTFMax, len(s))]))
+		if r == utf8.RuneError && size == 1 {
+			dst = append(dst, "\uFFFD"...)
+		} else {
+			dst = append(dst, s[i:i+size]...)
+		}
+		i += size
+	}
+	return dst
+}
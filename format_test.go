@@ -0,0 +1,260 @@
+package lgr
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Logger_buildJSONMessage(t *testing.T) {
+	outBuffer := bytes.NewBuffer(make([]byte, DEFAULT_OUT_BUFF))
+	l := Init()
+	lc := l.NewClient("client " + testlogstr)
+	ti := time.Date(2025, 1, 2, 3, 4, 5, 6, time.UTC)
+	msg := &logMessage{
+		pushed:  ti,
+		msgclnt: lc,
+		msgdata: testbytes,
+		fields: []Field{
+			Str("str", testlogstr), Int("int", -1), Uint64("uint", 2), Float64("float", 0.25),
+			Float64("nan", math.NaN()), Bool("bool", true), Duration("dur", time.Minute), Time("time2", ti),
+		},
+		msgtype: _MSG_LOG_TEXT,
+		annex:   basetype(LVL_WARN),
+	}
+	t.Run("valid_json", func(t *testing.T) {
+		s := buildJSONMessage(outBuffer, msg).String()
+		assert.True(t, strings.HasSuffix(s, "}\n"), "no line end")
+		assert.Equal(t, 1, strings.Count(s, "\n"), "multiline output")
+		var got map[string]any
+		assert.NoError(t, json.Unmarshal([]byte(s), &got), "invalid JSON: "+s)
+		assert.Equal(t, "2025-01-02T03:04:05.000000006Z", got[_KEY_TIME])
+		assert.Equal(t, LevelFullNames[LVL_WARN], got[_KEY_LEVEL])
+		// invalid UTF-8 byte \254 is replaced
+		assert.Equal(t, strings.ToValidUTF8("client "+testlogstr, "�"), got[_KEY_CLIENT])
+		assert.Equal(t, strings.ToValidUTF8(testlogstr, "�"), got[_KEY_MSG])
+		assert.Equal(t, strings.ToValidUTF8(testlogstr, "�"), got["str"])
+		assert.Equal(t, -1.0, got["int"])
+		assert.Equal(t, 2.0, got["uint"])
+		assert.Equal(t, 0.25, got["float"])
+		assert.Equal(t, "NaN", got["nan"])
+		assert.Equal(t, true, got["bool"])
+		assert.Equal(t, "1m0s", got["dur"])
+		assert.Equal(t, "2025-01-02T03:04:05.000000006Z", got["time2"])
+	})
+	t.Run("no_client", func(t *testing.T) {
+		s := buildJSONMessage(outBuffer, &logMessage{pushed: ti, msgdata: []byte("x")}).String()
+		assert.Equal(t, `{"time":"2025-01-02T03:04:05.000000006Z","level":"UNKNOWN","msg":"x"}`+"\n", s)
+	})
+	t.Run("nil_msg", func(t *testing.T) {
+		assert.Empty(t, buildJSONMessage(outBuffer, nil).String())
+	})
+}
+
+func Test_appendEscaped(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain", "abc", "abc"},
+		{"quotes", `"q" \`, `\"q\" \\`},
+		{"controls", "\n\r\t\a\x00\x7f", `\n\r\t\u0007\u0000\u007f`},
+		{"unicode", "АБВ 世界", "АБВ 世界"},
+		{"invalid", "a\xffb\xe4\xb8", "a�b��"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, string(appendEscaped(nil, tt.in)), "string")
+			assert.Equal(t, tt.want, string(appendEscaped(nil, []byte(tt.in))), "bytes")
+		})
+	}
+}
+
+func Test_Logger_SetOutputFormat(t *testing.T) {
+	out1 := &FakeWriter{}
+	out2 := &FakeWriter{}
+	l := InitWithParams(LVL_UNKNOWN, nil, out1, out2)
+	t.Run("setter", func(t *testing.T) {
+		assert.Nil(t, l.outputs[out1].formatter, "wrong default formatter")
+		got := l.SetOutputFormat(out1, FMT_JSON)
+		assert.Equal(t, l, got, "wrong return (must be self)")
+		assert.Equal(t, JSONFormatter{}, l.outputs[out1].formatter, "wrong format assignment")
+		l.SetOutputFormat(out2, FMT_LOGFMT)
+		assert.Equal(t, LogfmtFormatter{}, l.outputs[out2].formatter, "wrong format assignment")
+		l.SetOutputFormat(out2, _FMT_MAX_for_checks_only+1)
+		assert.Equal(t, TextFormatter{}, l.outputs[out2].formatter, "unknown format is not normalized")
+	})
+	t.Run("per_output", func(t *testing.T) {
+		lc := l.NewClient("db")
+		l.Start(0)
+		lc.LogInfo("login", Str("user", "bob"))
+		l.StopAndWait()
+		var got map[string]any
+		assert.NoError(t, json.Unmarshal(out1.buffer, &got), "invalid JSON: "+out1.String())
+		assert.Equal(t, "login", got[_KEY_MSG])
+		assert.Equal(t, "db", got[_KEY_CLIENT])
+		assert.Equal(t, "bob", got["user"])
+		assert.Equal(t, "db:login user=bob\n", out2.String())
+	})
+}
+
+func Test_Logger_buildLogfmtMessage(t *testing.T) {
+	outBuffer := bytes.NewBuffer(make([]byte, DEFAULT_OUT_BUFF))
+	l := Init()
+	lc := l.NewClient("db")
+	ti := time.Date(2025, 1, 2, 3, 4, 5, 6, time.UTC)
+	msg := &logMessage{pushed: ti, msgclnt: lc, annex: basetype(LVL_INFO)}
+	tests := []struct {
+		name    string
+		timefmt string
+		data    string
+		fields  []Field
+		want    string
+	}{
+		{"simple", "", "started", nil,
+			`ts=2025-01-02T03:04:05.000000006Z level=INFO client=db msg=started`},
+		{"timefmt", "2006-01-02 15:04:05", "started", nil,
+			`ts="2025-01-02 03:04:05" level=INFO client=db msg=started`},
+		{"spaces_quotes_newlines", time.DateOnly, "say \"hi\"\nnow", nil,
+			`ts=2025-01-02 level=INFO client=db msg="say \"hi\"\nnow"`},
+		{"unicode", time.DateOnly, "привет,世界", nil,
+			`ts=2025-01-02 level=INFO client=db msg=привет,世界`},
+		{"invalid_utf8", time.DateOnly, "a\xffb", nil,
+			`ts=2025-01-02 level=INFO client=db msg="a�b"`},
+		{"fields", time.DateOnly, "x", []Field{Str("user", "bob smith"), Int("n", 3), Str("empty", ""), Str("eq", "a=b"), Str("bs", `c:\d`)},
+			`ts=2025-01-02 level=INFO client=db msg=x user="bob smith" n=3 empty="" eq="a=b" bs="c:\\d"`},
+		{"bad_keys", time.DateOnly, "x", []Field{Str("a b", "1"), Str(`"q"=`, "2"), Str("", "3")},
+			`ts=2025-01-02 level=INFO client=db msg=x a_b=1 _q__=2 _=3`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg.msgdata = []byte(tt.data)
+			msg.fields = tt.fields
+			assert.Equal(t, tt.want+"\n", buildLogfmtMessage(outBuffer, msg, tt.timefmt).String())
+		})
+	}
+	t.Run("no_client", func(t *testing.T) {
+		s := buildLogfmtMessage(outBuffer, &logMessage{pushed: ti, msgdata: []byte("x")}, time.DateOnly).String()
+		assert.Equal(t, "ts=2025-01-02 level=UNKNOWN msg=x\n", s)
+	})
+	t.Run("nil_msg", func(t *testing.T) {
+		assert.Empty(t, buildLogfmtMessage(outBuffer, nil, "").String())
+	})
+	t.Run("output_timefmt", func(t *testing.T) {
+		out1 := &FakeWriter{}
+		l := InitWithParams(LVL_UNKNOWN, nil, out1)
+		l.SetOutputFormat(out1, FMT_LOGFMT).SetOutputTimeFormat(out1, time.DateOnly, " ")
+		lc := l.NewClient("db")
+		l.Start(0)
+		tm := lc.LogWarn(testlogstr)
+		l.StopAndWait()
+		assert.Equal(t, "ts="+tm.Format(time.DateOnly)+` level=WARN client=db msg="`+
+			string(appendEscaped(nil, testlogstr))+"\"\n", out1.String())
+	})
+}
+
+type testFormatter struct{}
+
+// Company-like layout: "LEVEL|client|message|k=v,k=v|fields count"
+func (testFormatter) Format(rec Record, buf *bytes.Buffer) {
+	buf.WriteString(LevelFullNames[rec.Level()])
+	buf.WriteByte('|')
+	buf.WriteString(rec.Client())
+	buf.WriteByte('|')
+	buf.Write(rec.AppendMessage(buf.AvailableBuffer()))
+	buf.WriteByte('|')
+	first := true
+	rec.Fields(func(f Field) bool {
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+		buf.WriteString(f.Key() + "=" + f.String())
+		return true
+	})
+	buf.WriteString("|" + strconv.Itoa(rec.NumFields()) + "\n")
+}
+
+func Test_Logger_SetOutputFormatter(t *testing.T) {
+	out1 := &FakeWriter{}
+	out2 := &FakeWriter{}
+	ferr := &FakeWriter{}
+	l := InitWithParams(LVL_UNKNOWN, ferr, out1, out2)
+	t.Run("setter", func(t *testing.T) {
+		got := l.SetOutputFormatter(out1, testFormatter{})
+		assert.Equal(t, l, got, "wrong return (must be self)")
+		assert.Equal(t, testFormatter{}, l.outputs[out1].formatter, "wrong formatter assignment")
+		l.SetOutputFormatter(out2, nil)
+		assert.Equal(t, TextFormatter{}, l.outputs[out2].formatter, "nil formatter is not replaced")
+	})
+	t.Run("per_output", func(t *testing.T) {
+		out1.Clear()
+		out2.Clear()
+		lc := l.NewClient("db")
+		l.Start(0)
+		lc.LogInfo("login", Str("user", "bob"), Int("n", 1))
+		lc.LogWarn("plain")
+		l.StopAndWait()
+		assert.Equal(t, "INFO|db|login|user=bob,n=1|2\nWARN|db|plain||0\n", out1.String())
+		assert.Equal(t, "db:login user=bob n=1\ndb:plain\n", out2.String())
+		assert.Empty(t, ferr.buffer)
+	})
+	t.Run("panicking_formatter", func(t *testing.T) {
+		out1.Clear()
+		out2.Clear()
+		l.SetOutputFormatter(out1, &panicFormatter{})
+		lc := l.NewClient("db")
+		l.Start(0)
+		lc.LogInfo("one")
+		lc.LogInfo("two")
+		l.StopAndWait()
+		assert.Empty(t, out1.buffer, "written after formatter panic")
+		assert.False(t, l.IsOutputEnabled(out1), "output is not disabled after formatter panic")
+		assert.Equal(t, "db:one\ndb:two\n", out2.String())
+		assert.Equal(t, 1, strings.Count(ferr.String(), panicStr), "wrong fallback: "+ferr.String())
+	})
+}
+
+type panicFormatter struct{}
+
+func (*panicFormatter) Format(rec Record, buf *bytes.Buffer) { panic(panicStr) }
+
+func Test_Record(t *testing.T) {
+	ti := time.Now()
+	l := Init()
+	lc := l.NewClient("db")
+	ctx := &outContext{timefmt: time.Kitchen}
+	rec := Record{&logMessage{pushed: ti, msgclnt: lc, msgdata: []byte("text"), fields: []Field{Int("a", 1), Int("b", 2)}, annex: basetype(LVL_ERROR)}, ctx}
+	t.Run("full", func(t *testing.T) {
+		assert.Equal(t, ti, rec.Time())
+		assert.Equal(t, LVL_ERROR, rec.Level())
+		assert.Equal(t, "db", rec.Client())
+		assert.Equal(t, "text", rec.Message())
+		assert.Equal(t, "<text", string(rec.AppendMessage([]byte("<"))))
+		assert.Equal(t, 2, rec.NumFields())
+		assert.Equal(t, time.Kitchen, rec.TimeFormat())
+		keys := ""
+		rec.Fields(func(f Field) bool { keys += f.Key(); return false }) // stops after first
+		assert.Equal(t, "a", keys)
+	})
+	t.Run("zero", func(t *testing.T) {
+		var rec Record
+		assert.NotPanics(t, func() {
+			assert.Zero(t, rec.Time())
+			assert.Equal(t, LVL_UNKNOWN, rec.Level())
+			assert.Empty(t, rec.Client())
+			assert.Empty(t, rec.Message())
+			assert.Nil(t, rec.AppendMessage(nil))
+			assert.Zero(t, rec.NumFields())
+			assert.Empty(t, rec.TimeFormat())
+			rec.Fields(func(f Field) bool { t.Fail(); return true })
+		})
+	})
+}
@@ -0,0 +1,143 @@
+package lgr
+
+/*
+Output health handling.
+
+An output is disabled automatically when writing to it panics (so a broken
+output doesn't panic on every message). Disabled outputs can be enabled again
+manually with Logger.SetOutputEnabled or automatically by the retry policy of
+the output (see Logger.SetOutputRetry): once the retry delay passes, the next
+message accepted by the output is written to it as a probe. The output is
+enabled again if the probe succeeds, otherwise the delay is doubled (up to the
+max delay) and the output stays disabled.
+
+Changes of the output state made by the processing goroutine (or by the writer
+goroutines of async outputs) are reported to the handler set by
+Logger.SetOutputStateHandler.
+*/
+
+import "time"
+
+// OutputStateHandler is called when an output is disabled automatically (err
+// describes the failure) or enabled again by the retry policy (err is nil). It is
+// called by the logger processing goroutine or by the writer goroutines of async
+// outputs (see Logger.SetOutputAsync), so it must be safe for concurrent calls.
+// The handler must not block: logging from it may wait for free space in the queue
+// that is drained by the processing goroutine.
+type OutputStateHandler func(output OutType, name string, enabled bool, err error)
+
+// outRetry holds the retry policy and state of an output.
+type outRetry struct {
+	min, max time.Duration // backoff delay limits (no retries if min is zero)
+	delay    time.Duration // current delay
+	next     time.Time     // time of the next probe (zero if not scheduled)
+	failed   bool          // whether the output is disabled automatically
+}
+
+// Enables or disables writes to the specified output. Enabling resets the retry
+// state of an output disabled automatically, disabling cancels scheduled retries.
+//
+// The operation is protected by mutex for thread safety.
+func (l *Logger) SetOutputEnabled(output OutType, enabled bool) *Logger {
+	return l.changeOutSettings(output, func(c *outContext) {
+		c.enabled = enabled
+		c.retry.reset()
+	})
+}
+
+// Sets the retry policy for the specified output disabled automatically after a
+// write panic. The first probe is made after minDelay, every failed probe doubles
+// the delay up to maxDelay (minDelay is used if maxDelay is less). Non-positive
+// minDelay disables retries (default).
+//
+// The operation is protected by mutex for thread safety.
+func (l *Logger) SetOutputRetry(output OutType, minDelay, maxDelay time.Duration) *Logger {
+	return l.changeOutSettings(output, func(c *outContext) {
+		c.retry.min = max(minDelay, 0)
+		c.retry.max = max(maxDelay, c.retry.min)
+		c.retry.delay, c.retry.next = 0, time.Time{}
+		if c.retry.failed {
+			c.retry.schedule()
+		}
+	})
+}
+
+// Sets the handler of output state changes (nil to remove it). The handler may be
+// called concurrently for async outputs (see OutputStateHandler).
+//
+// The operation is protected by mutex for thread safety.
+func (l *Logger) SetOutputStateHandler(handler OutputStateHandler) *Logger {
+	l.sync.chngMtx.Lock()
+	defer l.sync.chngMtx.Unlock()
+	l.outstate = handler
+	return l
+}
+
+// Returns whether a disabled output has to be probed now.
+func (r *outRetry) due() bool {
+	return !r.next.IsZero() && !time.Now().Before(r.next)
+}
+
+// Schedules the next probe with the backoff delay (if retries are enabled).
+func (r *outRetry) schedule() {
+	if r.min <= 0 {
+		return
+	}
+	if r.delay <= 0 {
+		r.delay = r.min
+	} else {
+		r.delay = min(r.delay*2, r.max)
+	}
+	r.next = time.Now().Add(r.delay)
+}
+
+// Clears the retry state keeping the policy.
+func (r *outRetry) reset() {
+	r.delay, r.next, r.failed = 0, time.Time{}, false
+}
+
+// Disables the output after a write panic or schedules the next probe after a
+// failed one (called by the goroutine writing the output or by the processing
+// goroutine).
+func (l *Logger) outputFailed(output OutType, context *outContext, err error) {
+	l.sync.outsMtx.Lock()
+	changed := context.enabled
+	context.enabled = false
+	if changed {
+		context.retry.delay = 0
+	}
+	context.retry.failed = true
+	context.retry.schedule()
+	name := context.name
+	l.sync.outsMtx.Unlock()
+	if changed {
+		l.notifyOutputState(output, name, false, err)
+	}
+}
+
+// Enables the output after a successful probe (called by the goroutine writing the
+// output).
+func (l *Logger) outputRecovered(output OutType, context *outContext) {
+	l.sync.outsMtx.Lock()
+	context.enabled = true
+	context.retry.reset()
+	name := context.name
+	l.sync.outsMtx.Unlock()
+	l.notifyOutputState(output, name, true, nil)
+}
+
+// Calls the output state handler. Handler panics are written to the fallback.
+func (l *Logger) notifyOutputState(output OutType, name string, enabled bool, err error) {
+	l.sync.chngMtx.RLock()
+	handler := l.outstate
+	l.sync.chngMtx.RUnlock()
+	if handler == nil {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			l.handleLogWriteError("panic in output state handler" + panicDesc(r))
+		}
+	}()
+	handler(output, name, enabled, err)
+}
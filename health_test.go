@@ -0,0 +1,156 @@
+package lgr
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// FlakyWriter panics on writes while broken.
+type FlakyWriter struct {
+	FakeWriter
+	broken bool
+}
+
+func (f *FlakyWriter) Write(b []byte) (int, error) {
+	if f.broken {
+		panic(panicStr)
+	}
+	return f.FakeWriter.Write(b)
+}
+
+type outputStateEvent struct {
+	name    string
+	enabled bool
+	failed  bool
+}
+
+// Returns a logger ready for direct logTextToOutputs calls and the list of
+// output state events.
+func newHealthLogger(outputs ...OutType) (*Logger, *[]outputStateEvent) {
+	events := &[]outputStateEvent{}
+	l := InitWithParams(LVL_UNKNOWN, &FakeWriter{}, outputs...)
+	l.msgbuf = bytes.NewBuffer(make([]byte, DEFAULT_OUT_BUFF))
+	l.SetOutputStateHandler(func(output OutType, name string, enabled bool, err error) {
+		*events = append(*events, outputStateEvent{name, enabled, err != nil})
+	})
+	return l, events
+}
+
+func Test_Logger_SetOutputEnabled(t *testing.T) {
+	out := &FlakyWriter{broken: true}
+	l, events := newHealthLogger(out)
+	l.SetOutputName(out, "flaky")
+	msg := &logMessage{msgtype: _MSG_LOG_TEXT, msgdata: []byte("a"), annex: basetype(LVL_INFO)}
+	l.logTextToOutputs(msg)
+	assert.False(t, l.IsOutputEnabled(out), "output is not disabled on panic")
+	assert.Equal(t, []outputStateEvent{{"flaky", false, true}}, *events)
+	assert.Zero(t, l.outputs[out].retry.next, "retry is scheduled without policy")
+
+	out.broken = false
+	l.logTextToOutputs(msg)
+	assert.Empty(t, out.String(), "disabled output is written")
+	l.SetOutputEnabled(out, true)
+	assert.True(t, l.IsOutputEnabled(out))
+	assert.False(t, l.outputs[out].retry.failed)
+	l.logTextToOutputs(msg)
+	assert.Equal(t, "a\n", out.String())
+
+	l.SetOutputEnabled(out, false)
+	l.logTextToOutputs(msg)
+	assert.Equal(t, "a\n", out.String(), "manually disabled output is written")
+	assert.Len(t, *events, 1, "manual changes are reported")
+	l.SetOutputEnabled(&FakeWriter{}, true) // no panic for unknown output
+}
+
+func Test_Logger_SetOutputRetry(t *testing.T) {
+	const minDelay, maxDelay = time.Hour, 3 * time.Hour
+	out := &FlakyWriter{broken: true}
+	l, events := newHealthLogger(out)
+	l.SetOutputRetry(out, minDelay, maxDelay)
+	msg := &logMessage{msgtype: _MSG_LOG_TEXT, msgdata: []byte("a"), annex: basetype(LVL_INFO)}
+	retry := &l.outputs[out].retry
+
+	t0 := time.Now()
+	l.logTextToOutputs(msg)
+	assert.False(t, l.IsOutputEnabled(out))
+	assert.Equal(t, minDelay, retry.delay)
+	assert.WithinRange(t, retry.next, t0.Add(minDelay), time.Now().Add(minDelay))
+
+	l.logTextToOutputs(msg) // not due yet
+	assert.Equal(t, uint64(1), l.outputs[out].stats.panics.Load(), "output is probed before the delay")
+
+	for _, want := range []time.Duration{2 * minDelay, maxDelay, maxDelay} {
+		retry.next = time.Now() // make the probe due
+		l.logTextToOutputs(msg)
+		assert.False(t, l.IsOutputEnabled(out), "output is enabled after a failed probe")
+		assert.Equal(t, want, retry.delay, "wrong backoff")
+	}
+	assert.Len(t, *events, 1, "failed probes are reported")
+
+	out.broken = false
+	retry.next = time.Now()
+	l.SetOutputMinLevel(out, LVL_WARN)
+	l.logTextToOutputs(msg) // filtered message is not a probe
+	assert.False(t, l.IsOutputEnabled(out))
+	l.SetOutputMinLevel(out, LVL_UNKNOWN)
+	l.logTextToOutputs(msg)
+	assert.True(t, l.IsOutputEnabled(out), "output is not enabled after a successful probe")
+	assert.Equal(t, "a\n", out.String())
+	assert.Zero(t, retry.next)
+	assert.Zero(t, retry.delay)
+	assert.Equal(t, outputStateEvent{"output1", true, false}, (*events)[1])
+
+	t.Run("error_probe", func(t *testing.T) {
+		l, _ := newHealthLogger(&ErrorWriter{})
+		for out := range l.outputs {
+			l.SetOutputRetry(out, minDelay, 0)
+			l.outputFailed(out, l.outputs[out], nil)
+			l.outputs[out].retry.next = time.Now()
+			l.logTextToOutputs(msg)
+			assert.False(t, l.IsOutputEnabled(out), "output is enabled after a write error")
+			assert.Equal(t, minDelay, l.outputs[out].retry.delay, "max delay is less than min")
+		}
+	})
+	t.Run("after_failure", func(t *testing.T) {
+		l, _ := newHealthLogger(out)
+		out.broken = true
+		l.logTextToOutputs(msg)
+		assert.Zero(t, l.outputs[out].retry.next)
+		l.SetOutputRetry(out, minDelay, maxDelay)
+		assert.False(t, l.outputs[out].retry.next.IsZero(), "retry is not scheduled for failed output")
+		l.SetOutputRetry(out, 0, 0)
+		assert.Zero(t, l.outputs[out].retry.next, "retry is not canceled")
+	})
+}
+
+func Test_Logger_SetOutputStateHandler_Panic(t *testing.T) {
+	ferr := &FakeWriter{}
+	l := InitWithParams(LVL_UNKNOWN, ferr, &PanicWriter{})
+	l.msgbuf = bytes.NewBuffer(make([]byte, DEFAULT_OUT_BUFF))
+	l.SetOutputStateHandler(func(OutType, string, bool, error) { panic("handler") })
+	assert.NotPanics(t, func() {
+		l.logTextToOutputs(&logMessage{msgtype: _MSG_LOG_TEXT, msgdata: []byte("a")})
+	})
+	assert.Contains(t, ferr.String(), "panic in output state handler")
+}
+
+func Test_Logger_OutputRetry_Running(t *testing.T) {
+	out := &FlakyWriter{broken: true}
+	l := InitWithParams(LVL_UNKNOWN, &FakeWriter{}, out)
+	l.SetOutputRetry(out, time.Millisecond, time.Millisecond)
+	enabled := make(chan bool, 2)
+	l.SetOutputStateHandler(func(_ OutType, _ string, e bool, _ error) { enabled <- e })
+	lc := l.NewClient("")
+	l.Start(4)
+	lc.LogInfo("a")
+	assert.False(t, <-enabled)
+	out.broken = false // safe: the output is not written until the next probe
+	time.Sleep(2 * time.Millisecond)
+	lc.LogInfo("b")
+	assert.True(t, <-enabled)
+	l.StopAndWait()
+	assert.Equal(t, ":b\n", out.String())
+}
@@ -0,0 +1,70 @@
+package lgr
+
+/*
+Lifecycle state and transition hooks.
+
+Logger.State returns the current lifecycle state. The handler set by
+Logger.SetLifecycleHandler is notified about transitions:
+  - LIFECYCLE_STARTED: Start (or Restart of an inactive logger) is done
+  - LIFECYCLE_STOPPING: Stop closed the queue, queued messages are being written
+  - LIFECYCLE_STOPPED: the processing goroutine has finished
+  - LIFECYCLE_PANICKED: the processing goroutine has recovered a panic and quits
+    (followed by LIFECYCLE_STOPPED), so queued messages are not written
+
+A supervisor can restart logging from the handler, e.g. by calling Start on
+LIFECYCLE_STOPPED after LIFECYCLE_PANICKED.
+*/
+
+type LifecycleEvent basetype // Logger lifecycle transition (see SetLifecycleHandler)
+
+const (
+	// Lifecycle transitions passed to LifecycleHandler.
+	LIFECYCLE_STARTED LifecycleEvent = iota
+	LIFECYCLE_STOPPING
+	LIFECYCLE_STOPPED
+	LIFECYCLE_PANICKED
+	_LIFECYCLE_MAX_for_checks_only
+)
+
+// LifecycleHandler is called on logger lifecycle transitions (err describes the
+// panic for LIFECYCLE_PANICKED and is nil otherwise). It is called without logger
+// locks held, so it may call Start, Stop, State etc., but must not block: it runs
+// in the goroutine calling Start/Stop or in the processing goroutine.
+type LifecycleHandler func(event LifecycleEvent, err error)
+
+// Returns the current logger lifecycle state ([STATE_ACTIVE], [STATE_STOPPING]
+// or [STATE_STOPPED]).
+//
+// The operation is protected by mutex for thread safety.
+func (l *Logger) State() LoggerState {
+	l.sync.statMtx.RLock()
+	defer l.sync.statMtx.RUnlock()
+	return l.state
+}
+
+// Sets the handler notified about logger lifecycle transitions (nil to remove).
+//
+// The operation is protected by mutex for thread safety.
+func (l *Logger) SetLifecycleHandler(handler LifecycleHandler) *Logger {
+	l.sync.chngMtx.Lock()
+	defer l.sync.chngMtx.Unlock()
+	l.lifecycle = handler
+	return l
+}
+
+// Calls the lifecycle handler (if set) recovering its panics. Must be called
+// without the state lock held.
+func (l *Logger) notifyLifecycle(event LifecycleEvent, err error) {
+	l.sync.chngMtx.RLock()
+	handler := l.lifecycle
+	l.sync.chngMtx.RUnlock()
+	if handler == nil {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			l.handleLogWriteError("panic in lifecycle handler" + panicDesc(r))
+		}
+	}()
+	handler(event, err)
+}
@@ -0,0 +1,94 @@
+package lgr
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type lifecycleEvent struct {
+	event LifecycleEvent
+	err   error
+}
+
+// Returns a logger with the lifecycle handler sending events to the returned channel.
+func newLifecycleLogger(outputs ...OutType) (*Logger, chan lifecycleEvent) {
+	events := make(chan lifecycleEvent, 16)
+	l := InitWithParams(LVL_UNKNOWN, &FakeWriter{}, outputs...)
+	l.SetLifecycleHandler(func(event LifecycleEvent, err error) {
+		events <- lifecycleEvent{event, err}
+	})
+	return l, events
+}
+
+func nextEvent(t *testing.T, events chan lifecycleEvent) lifecycleEvent {
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("no lifecycle event")
+	}
+	return lifecycleEvent{}
+}
+
+func Test_Logger_State(t *testing.T) {
+	l, events := newLifecycleLogger()
+	assert.Equal(t, STATE_STOPPED, l.State())
+	l.Start(4)
+	assert.Equal(t, STATE_ACTIVE, l.State())
+	assert.Equal(t, lifecycleEvent{LIFECYCLE_STARTED, nil}, nextEvent(t, events))
+	l.Restart(8)
+	l.Stop()
+	assert.Contains(t, []LoggerState{STATE_STOPPING, STATE_STOPPED}, l.State())
+	assert.Equal(t, lifecycleEvent{LIFECYCLE_STOPPING, nil}, nextEvent(t, events), "event on restart of active logger")
+	l.Wait()
+	assert.Equal(t, STATE_STOPPED, l.State())
+	assert.Equal(t, lifecycleEvent{LIFECYCLE_STOPPED, nil}, nextEvent(t, events))
+	l.Stop()
+	l.Restart(4)
+	assert.Equal(t, lifecycleEvent{LIFECYCLE_STARTED, nil}, nextEvent(t, events), "inactive logger is not started")
+	l.SetLifecycleHandler(nil)
+	l.StopAndWait()
+	assert.Empty(t, events)
+}
+
+func Test_Logger_Lifecycle_Panic(t *testing.T) {
+	out := &FakeWriter{}
+	l, events := newLifecycleLogger(out)
+	panicked := false // handler calls are sequential
+	l.SetLifecycleHandler(func(event LifecycleEvent, err error) {
+		events <- lifecycleEvent{event, err}
+		switch event {
+		case LIFECYCLE_PANICKED:
+			panicked = true
+		case LIFECYCLE_STOPPED:
+			if panicked {
+				panicked = false
+				l.Start(4) // supervisor restart after the panic
+			}
+		}
+	})
+	l.Start(4)
+	nextEvent(t, events)
+	l.pushMessage(&logMessage{msgtype: _MSG_FORBIDDEN})
+	e := nextEvent(t, events)
+	assert.Equal(t, LIFECYCLE_PANICKED, e.event)
+	assert.ErrorContains(t, e.err, "panic proceeding log")
+	assert.Equal(t, LIFECYCLE_STOPPED, nextEvent(t, events).event)
+	assert.Equal(t, LIFECYCLE_STARTED, nextEvent(t, events).event, "not restarted from the handler")
+	l.NewClient("").LogInfo("a")
+	l.StopAndWait()
+	assert.Equal(t, ":a\n", out.String())
+}
+
+func Test_Logger_Lifecycle_HandlerPanic(t *testing.T) {
+	ferr := &FakeWriter{}
+	l := InitWithParams(LVL_UNKNOWN, ferr)
+	l.SetLifecycleHandler(func(LifecycleEvent, error) { panic(errors.New("oops")) })
+	assert.NoError(t, l.Start(4))
+	l.StopAndWait()
+	assert.Equal(t, STATE_STOPPED, l.State())
+	assert.Contains(t, ferr.String(), "panic in lifecycle handler: (error) `oops`")
+}
@@ -11,6 +11,7 @@ import (
 	"errors"
 	"io"
 	"os"
+	"strconv"
 	"time"
 )
 
@@ -63,10 +64,12 @@ func Init(outputs ...OutType) *Logger {
 // log messages.
 func InitWithParams(level LogLevel, fallback OutType, outputs ...OutType) *Logger {
 	l := new(Logger)
-	l.state = _STATE_STOPPED
+	l.state = STATE_STOPPED
 	l.outputs = outList{}
+	l.overflow.room = make(chan struct{}, 1)
 	l.SetMinLevel(level)
 	l.SetFallback(fallback)
+	l.SetOverflowPriority(DEFAULT_GUARANTEED_LEVEL, DEFAULT_SHED_LEVEL, DEFAULT_QUEUE_RESERVE)
 	l.AddOutputs(outputs...)
 	return l
 }
@@ -77,19 +80,81 @@ func InitWithParams(level LogLevel, fallback OutType, outputs ...OutType) *Logge
 //
 // The started goroutine will run procced() and is tracked by the internal
 // wait group so callers can Wait() for graceful shutdown.
+//
+// A stopped logger can be started again. If the previous processing goroutine
+// is still draining its queue (STATE_STOPPING), the new one waits for it, so
+// messages are written in the order they were queued.
 func (l *Logger) Start(buffsize int) error {
 	l.sync.statMtx.Lock()
-	defer l.sync.statMtx.Unlock()
 	if l.IsActive() {
+		l.sync.statMtx.Unlock()
 		return errors.New(_ERROR_MESSAGE_LOGGER_STARTED)
 	}
+	l.abandon.Store(false)
+	l.start(buffsize)
+	l.sync.statMtx.Unlock()
+	l.notifyLifecycle(LIFECYCLE_STARTED, nil)
+	return nil
+}
+
+// Replaces the logger channel with a new one of the provided buffsize capacity
+// (DEFAULT_MSG_BUFF for negative) without losing messages: the old channel is
+// closed and drained by its processing goroutine, then the new goroutine starts
+// processing the new channel. Logging calls made meanwhile wait for the switch
+// and are queued to the new channel. An inactive logger is just started (there are
+// no lifecycle notifications for an active one).
+//
+// Preferred usage example (resizing the queue on the fly):
+//
+//	logger.Restart(4 * DEFAULT_MSG_BUFF)
+func (l *Logger) Restart(buffsize int) {
+	l.sync.statMtx.Lock()
+	active := l.IsActive()
+	if active {
+		close(l.channel)
+	} else {
+		l.abandon.Store(false)
+	}
+	l.start(buffsize)
+	l.sync.statMtx.Unlock()
+	if !active {
+		l.notifyLifecycle(LIFECYCLE_STARTED, nil)
+	}
+}
+
+// Creates the channel and launches the processing goroutine chained after the
+// previous one (must be called with the state lock held). The previous goroutine
+// releases the next one before taking the state lock, as logging calls blocked on
+// the full new channel hold it.
+func (l *Logger) start(buffsize int) {
 	if buffsize <= 0 {
 		buffsize = DEFAULT_MSG_BUFF
 	}
-	l.channel = make(chan logMessage, buffsize)
-	l.sync.waitEnd.Go(func() { l.procced() })
-	l.state = _STATE_ACTIVE
-	return nil
+	channel, prevDrained := make(chan logMessage, buffsize), l.procDrained
+	drained, procEnd, next := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	if l.procNext != nil {
+		close(l.procNext)
+	}
+	l.channel, l.procDrained, l.procEnd, l.procNext = channel, drained, procEnd, next
+	l.sync.waitEnd.Go(func() {
+		defer close(procEnd)
+		if prevDrained != nil {
+			// the previous goroutine writes the messages queued before
+			<-prevDrained
+		}
+		l.procced(channel)
+		select {
+		case <-next:
+			// restarted: the async writers are taken over by the next goroutine
+		default:
+			l.stopAllAsync()
+		}
+		close(drained)
+		if l.setStoppedFor(channel) {
+			l.notifyLifecycle(LIFECYCLE_STOPPED, nil)
+		}
+	})
+	l.state = STATE_ACTIVE
 }
 
 // Stop initiates logger shutdown. It sets STATE_STOPPING and closes the channel
@@ -100,10 +165,15 @@ func (l *Logger) Start(buffsize int) error {
 // messages.
 func (l *Logger) Stop() {
 	l.sync.statMtx.Lock()
-	defer l.sync.statMtx.Unlock()
-	if l.IsActive() {
-		l.state = _STATE_STOPPING
+	active := l.IsActive()
+	if active {
+		l.state = STATE_STOPPING
 		close(l.channel)
+		l.signalRoom() // callers waiting for room give up
+	}
+	l.sync.statMtx.Unlock()
+	if active {
+		l.notifyLifecycle(LIFECYCLE_STOPPING, nil)
 	}
 }
 
@@ -154,11 +224,18 @@ func (l *Logger) SetFallback(f OutType) *Logger {
 
 // True if the logger is in active state (i.e. ready to proceed log messages).
 func (l *Logger) IsActive() bool {
-	return l.state == _STATE_ACTIVE
+	return l.state == STATE_ACTIVE
 }
 
 // Attaches one or more outputs (io.Writer) to the logger and creates a
-// default context for each. Nil outputs are ignored.
+// default context for each. Nil outputs are ignored. Errors occurred in
+// background work of outputs (e.g. compression of rotated files) are written
+// to the logger fallback.
+//
+// The default output name (used in statistics and metrics) is the result of
+// Name() method for outputs having it (like [os.File]) or "output<N>" with the
+// sequential number of the output (see SetOutputName). A name already used by
+// another output gets the "#<N>" suffix.
 //
 // The operation is protected by mutex for thread safety.
 //
@@ -166,9 +243,16 @@ func (l *Logger) IsActive() bool {
 // will be directed to the updated set of outputs).
 func (l *Logger) AddOutputs(outputs ...OutType) *Logger {
 	l.operateOutputs(outputs, func(m *outList, k OutType) {
+		l.outseq++
 		(*m)[k] = &outContext{
+			name:      m.uniqueName(k, defaultOutputName(k, l.outseq), l.outseq),
 			enabled:   true,
 			delimiter: []byte(DEFAULT_DELIMITER),
+			fieldsep:  []byte(DEFAULT_FIELD_SEP),
+			fieldasg:  []byte(DEFAULT_FIELD_ASSIGN),
+		}
+		if er, ok := k.(errorReporter); ok {
+			er.setErrorHandler(l.handleLogWriteError)
 		}
 	})
 	return l
@@ -253,14 +337,17 @@ func (l *Logger) SetOutputLevelColor(output OutType, colormap *LevelMap) *Logger
 }
 
 // Sets the time.Format string used to prefix messages for the specified output. If empty
-// no timestamp is written.
+// no timestamp is written. The delimiter is written after the timestamp in text format.
+//
+// The format is also used for `ts` key of [FMT_LOGFMT] format.
 //
 // More about time format layouts at https://pkg.go.dev/time#Layout. Example:
 //
 //	"2006-01-02 15:04:05"
 func (l *Logger) SetOutputTimeFormat(output OutType, format, delimiter string) *Logger {
 	return l.changeOutSettings(output, func(c *outContext) {
-		c.timefmt = format + delimiter
+		c.timefmt = format
+		c.timedlm = []byte(delimiter)
 	})
 }
 
@@ -281,6 +368,65 @@ func (l *Logger) SetOutputMinLevel(output OutType, minlevel LogLevel) *Logger {
 	})
 }
 
+// Sets the separators used to render structured fields for the specified output:
+// separator is written before each field, assign between the field key and value.
+//
+// Defaults are [DEFAULT_FIELD_SEP] and [DEFAULT_FIELD_ASSIGN] (`msg key=value`).
+func (l *Logger) SetOutputFieldFormat(output OutType, separator, assign string) *Logger {
+	return l.changeOutSettings(output, func(c *outContext) {
+		c.fieldsep = []byte(separator)
+		c.fieldasg = []byte(assign)
+	})
+}
+
+// Sets the built-in message format for the specified output (see [FMT_TEXT], [FMT_JSON],
+// [FMT_LOGFMT]). Unknown formats are replaced with [FMT_TEXT]. Replaces the formatter
+// set by SetOutputFormatter.
+//
+// Machine-readable formats ignore text decoration settings (prefixes, colors etc.).
+func (l *Logger) SetOutputFormat(output OutType, format OutFormat) *Logger {
+	return l.SetOutputFormatter(output, formatterOf(format))
+}
+
+// Sets a custom formatter for the specified output ([TextFormatter] is used if
+// nil). The formatter is called in the logger processing goroutine.
+func (l *Logger) SetOutputFormatter(output OutType, formatter Formatter) *Logger {
+	if formatter == nil {
+		formatter = TextFormatter{}
+	}
+	return l.changeOutSettings(output, func(c *outContext) {
+		c.formatter = formatter
+	})
+}
+
+// Sets the name of the specified output used in statistics and metrics.
+func (l *Logger) SetOutputName(output OutType, name string) *Logger {
+	return l.changeOutSettings(output, func(c *outContext) {
+		c.name = name
+	})
+}
+
+// Returns the default output name: the result of Name() method if the output
+// has one, "output<seq>" otherwise.
+func defaultOutputName(output OutType, seq int) string {
+	if named, ok := output.(interface{ Name() string }); ok {
+		if name := named.Name(); len(name) > 0 {
+			return name
+		}
+	}
+	return "output" + strconv.Itoa(seq)
+}
+
+// Returns the name with the "#<seq>" suffix if another output of the list has it.
+func (m outList) uniqueName(output OutType, name string, seq int) string {
+	for k, c := range m {
+		if k != output && c != nil && c.name == name {
+			return name + "#" + strconv.Itoa(seq)
+		}
+	}
+	return name
+}
+
 // Safely modifies a context with a given function for the given output (if it exists).
 func (l *Logger) changeOutSettings(output OutType, f func(*outContext)) *Logger {
 	if l.outputs[output] != nil {
@@ -293,10 +439,11 @@ func (l *Logger) changeOutSettings(output OutType, f func(*outContext)) *Logger
 
 /////////////////////////////////////////////////////////////////////////////////////////
 
-// Attempts to enqueue a logMessage into the logger's channel. It returns the
-// timestamp (t) that represents the push time and an error if the message could
-// not be enqueued. Catches any panics (including writing to the closed channel)
-// and converts them to errors.
+// Attempts to enqueue a logMessage into the logger's channel according to the
+// overflow policy. It returns the timestamp (t) that represents the push time and
+// an error if the message could not be enqueued (ErrMessageDropped if dropped).
+// Catches any panics (including writing to the closed channel) and converts them
+// to errors.
 func (l *Logger) pushMessage(msg *logMessage) (t time.Time, err error) {
 	l.sync.statMtx.RLock()
 	defer func() {
@@ -317,22 +464,31 @@ func (l *Logger) pushMessage(msg *logMessage) (t time.Time, err error) {
 			} else {
 				// will panic if channel is closed (with recover and setting error)
 				msg.pushed = t1
-				l.channel <- *msg
-				t = t1
+				if err = l.sendMessage(msg); err == nil {
+					t = t1
+					if msg.msgtype == _MSG_LOG_TEXT {
+						l.countEnqueued(msg)
+					}
+				}
 			}
 		}
 	}
 	return t, err
 }
 
-// Helper to build a logMessage representing a textual log entry
-func makeTextMessage(lc *LogClient, level LogLevel, data []byte) *logMessage {
-	return &logMessage{
+// Helper to build a logMessage representing a textual log entry. Fields are copied
+// so the caller can't change them after the message is queued.
+func makeTextMessage(lc *LogClient, level LogLevel, data []byte, fields ...Field) *logMessage {
+	msg := &logMessage{
 		msgtype: _MSG_LOG_TEXT,
 		msgclnt: lc,
 		msgdata: data,
 		annex:   basetype(level),
 	}
+	if len(fields) > 0 {
+		msg.fields = append([]Field(nil), fields...)
+	}
+	return msg
 }
 
 // Helper to build a command message (used to change something in queued order to prevent
@@ -399,6 +555,7 @@ func (l *Logger) NewClientWithLevel(name string, minlevel LogLevel) *LogClient {
 		curLevel: LVL_UNKNOWN, // Used only for io.Writer usage
 		enabled:  true,
 	}
+	l.registerClient(client)
 	return client
 }
 
@@ -467,8 +624,39 @@ func clientChangeFromCmdMsg(msg *logMessage, f func(*LogClient, []byte)) (errstr
 	return
 }
 
-// LogBytes_with_err enqueues a raw byte payload as a log message at the given
-// level. It returns the push timestamp and an error if the logger is nil,
+// Reports whether a message of the level would be written by at least one output:
+// the client is enabled, the level passes the client, logger-wide and output min
+// levels of an enabled output (or of an output waiting for a retry probe, see
+// SetOutputRetry). Use it to skip building expensive messages:
+//
+//	if client.Enabled(LVL_DEBUG) {
+//	    client.LogDebug(dumpState())
+//	}
+//
+// The result may be outdated if settings are changed concurrently.
+func (lc *LogClient) Enabled(level LogLevel) bool {
+	if lc == nil || !lc.accepts(level) {
+		return false
+	}
+	l := lc.logger
+	l.sync.outsMtx.RLock()
+	defer l.sync.outsMtx.RUnlock()
+	for _, context := range l.outputs {
+		if context != nil && (context.enabled || context.retry.failed && context.retry.min > 0) && level >= context.minlevel {
+			return true
+		}
+	}
+	return false
+}
+
+// Reports whether a message of the level passes the logger-wide and client
+// filtering (the same checks as in LogBytes_with_err).
+func (lc *LogClient) accepts(level LogLevel) bool {
+	return lc.logger != nil && lc.enabled && level >= lc.logger.level && level >= lc.minLevel
+}
+
+// LogBytes_with_err enqueues a raw byte payload with optional structured fields
+// as a log message at the given level. It returns the push timestamp and an error if the logger is nil,
 // inactive, the channel is unavailable, or a panic occurred while sending.
 //
 // Filtering behavior: the call is a no-op and returns zero time + nil error
@@ -479,7 +667,13 @@ func clientChangeFromCmdMsg(msg *logMessage, f func(*LogClient, []byte)) (errstr
 //
 // Note: There is a test-only check that panics if logger.level is invalid; in
 // normal code SetMinLevel/normLevel should prevent invalid level values.
-func (lc *LogClient) LogBytes_with_err(level LogLevel, data []byte) (t time.Time, err error) {
+func (lc *LogClient) LogBytes_with_err(level LogLevel, data []byte, fields ...Field) (t time.Time, err error) {
+	return lc.logBytes(level, data, nil, fields)
+}
+
+// Implementation of LogBytes_with_err. Non-nil args make data a format string for
+// the processing goroutine (see Logf_deferred).
+func (lc *LogClient) logBytes(level LogLevel, data []byte, args []any, fields []Field) (t time.Time, err error) {
 	// Apply global and per-client filtering before enqueuing
 	switch { // conditions NOT to log (instead of long-long if)
 	case lc.logger == nil:
@@ -489,21 +683,24 @@ func (lc *LogClient) LogBytes_with_err(level LogLevel, data []byte) (t time.Time
 	case lc.logger.level > _LVL_MAX_for_checks_only:
 		// For testing purposes only — exercising panic recovery paths.
 		panic(errors.New(_ERROR_MESSAGE_TEST_PANIC_TEXT))
-	case !lc.enabled: // logger client is disabled
-	case level < lc.logger.level: // message level is lower than logger-wide minimum level
-	case level < lc.minLevel: // message level is lower than logger client minimum level
-	case len(data) == 0: // we don't like to write empty messages
+	case !lc.enabled, // logger client is disabled
+		level < lc.logger.level, // message level is lower than logger-wide minimum level
+		level < lc.minLevel:     // message level is lower than logger client minimum level
+		lc.logger.countFiltered(lc, level)
+	case len(data) == 0 && len(fields) == 0: // we don't like to write empty messages
 	default:
-		t, err = lc.logger.pushMessage(makeTextMessage(lc, level, data))
+		msg := makeTextMessage(lc, level, data, fields...)
+		msg.args = args
+		t, err = lc.logger.pushMessage(msg)
 	}
 	return t, err
 }
 
 // Same as LogBytes_with_err() but underlying enqueue/write error is written to
-// logger fallback. Returns zero time on error.
-func (lc *LogClient) LogBytes(level LogLevel, data []byte) time.Time {
-	t, err := lc.LogBytes_with_err(level, data)
-	if err != nil && lc.logger != nil {
+// logger fallback (except ErrMessageDropped). Returns zero time on error.
+func (lc *LogClient) LogBytes(level LogLevel, data []byte, fields ...Field) time.Time {
+	t, err := lc.LogBytes_with_err(level, data, fields...)
+	if err != nil && err != ErrMessageDropped && lc.logger != nil {
 		// Report the write/enqueue error to the logger fallback. This keeps the
 		// simple Log* API ergonomic while still surfacing failures.
 		lc.logger.handleLogWriteError(err.Error())
@@ -520,8 +717,8 @@ func (lc *LogClient) LogBytes(level LogLevel, data []byte) time.Time {
 //	Log()
 //
 // instead.
-func (lc *LogClient) Log_with_err(level LogLevel, s string) (time.Time, error) {
-	return lc.LogBytes_with_err(level, []byte(s))
+func (lc *LogClient) Log_with_err(level LogLevel, s string, fields ...Field) (time.Time, error) {
+	return lc.LogBytes_with_err(level, []byte(s), fields...)
 }
 
 // Writes a string as log message at the provided level. Returns the time
@@ -534,15 +731,18 @@ func (lc *LogClient) Log_with_err(level LogLevel, s string) (time.Time, error) {
 //	Log_with_err()
 //
 // when callers need to react to delivery problems.
-func (lc *LogClient) Log(level LogLevel, s string) time.Time {
-	return lc.LogBytes(level, []byte(s))
+func (lc *LogClient) Log(level LogLevel, s string, fields ...Field) time.Time {
+	return lc.LogBytes(level, []byte(s), fields...)
 }
 
 /////////////////////////////////////////////////////////////////////////////////////////
 /*
 Convenience level-specific helpers for common log levels.
 These are thin wrappers around LogBytes that provide inline hints in
-editors and documentation tools.
+editors and documentation tools. All of them accept optional structured
+fields (see Str, Int, Err etc.), e.g.
+
+	client.LogInfo("login", lgr.Str("user", u), lgr.Int("attempt", n))
 
 All of these helpers behave like LogBytes: they do not return an error.
 If an enqueue/write error occurs it will be reported to the logger's
@@ -556,8 +756,8 @@ fallback writer (via handleLogWriteError).
 // the logger fallback writer.
 //
 // Logger commands are written to log with this level.
-func (lc *LogClient) LogTrace(s string) time.Time {
-	return lc.LogBytes(LVL_TRACE, []byte(s))
+func (lc *LogClient) LogTrace(s string, fields ...Field) time.Time {
+	return lc.LogBytes(LVL_TRACE, []byte(s), fields...)
 }
 
 // Logs a textual message at DEBUG level. Returns the time the message was queued
@@ -565,8 +765,8 @@ func (lc *LogClient) LogTrace(s string) time.Time {
 // message will be written as a string to the logger fallback.
 //
 // Intended for developer-focused debugging output.
-func (lc *LogClient) LogDebug(s string) time.Time {
-	return lc.LogBytes(LVL_DEBUG, []byte(s))
+func (lc *LogClient) LogDebug(s string, fields ...Field) time.Time {
+	return lc.LogBytes(LVL_DEBUG, []byte(s), fields...)
 }
 
 // Logs an informational message at INFO level. Returns the time the message was queued
@@ -574,8 +774,8 @@ func (lc *LogClient) LogDebug(s string) time.Time {
 // message will be written as a string to the logger fallback.
 //
 // Use for normal operational messages.
-func (lc *LogClient) LogInfo(s string) time.Time {
-	return lc.LogBytes(LVL_INFO, []byte(s))
+func (lc *LogClient) LogInfo(s string, fields ...Field) time.Time {
+	return lc.LogBytes(LVL_INFO, []byte(s), fields...)
 }
 
 // LogWarn logs a warning message at WARN level. Returns the time the message was queued
@@ -583,8 +783,8 @@ func (lc *LogClient) LogInfo(s string) time.Time {
 // message will be written as a string to the logger fallback.
 //
 // Use for recoverable or noteworthy conditions that deserve attention.
-func (lc *LogClient) LogWarn(s string) time.Time {
-	return lc.LogBytes(LVL_WARN, []byte(s))
+func (lc *LogClient) LogWarn(s string, fields ...Field) time.Time {
+	return lc.LogBytes(LVL_WARN, []byte(s), fields...)
 }
 
 // LogError logs an error-level message. Returns the time the message was queued
@@ -597,8 +797,8 @@ func (lc *LogClient) LogWarn(s string) time.Time {
 //	LogErr(e error)
 //
 // to log error instead of string.
-func (lc *LogClient) LogError(s string) time.Time {
-	return lc.LogBytes(LVL_ERROR, []byte(s))
+func (lc *LogClient) LogError(s string, fields ...Field) time.Time {
+	return lc.LogBytes(LVL_ERROR, []byte(s), fields...)
 }
 
 // LogErr logs an error.Value at ERROR level. Returns the time the message was queued
@@ -612,8 +812,8 @@ func (lc *LogClient) LogError(s string) time.Time {
 //	LogError(err.Error())
 //
 // but clearer at call sites when you already have an error object.
-func (lc *LogClient) LogErr(e error) time.Time {
-	return lc.LogBytes(LVL_ERROR, []byte(e.Error()))
+func (lc *LogClient) LogErr(e error, fields ...Field) time.Time {
+	return lc.LogBytes(LVL_ERROR, []byte(e.Error()), fields...)
 }
 
 // LogFatal logs an error.Value at FATAL level. Returns the time the message was queued
@@ -623,8 +823,8 @@ func (lc *LogClient) LogErr(e error) time.Time {
 // This is a non-full analog to stanfard log.Fatal(): it calls LogErr() but do NOT exits
 // program: os.Exit(1) makes impossible to gracefully shutdown logger and guarantee than
 // all log messages would be written to log outputs.
-func (lc *LogClient) LogFatal(e error) time.Time {
-	return lc.LogBytes(LVL_FATAL, []byte(e.Error()))
+func (lc *LogClient) LogFatal(e error, fields ...Field) time.Time {
+	return lc.LogBytes(LVL_FATAL, []byte(e.Error()), fields...)
 }
 
 // Fatal checks if logger exists and is active, if yes - logs an error.Error() at FATAL level under
@@ -9,6 +9,8 @@ import (
 	"os/exec"
 	"runtime"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -238,8 +240,8 @@ func Test_Logger_IsActive(t *testing.T) {
 	rng := 256
 	t.Run("one_from_255", func(t *testing.T) {
 		for i := range rng {
-			l.setState(lgrState(i))
-			assert.Equal(t, l.state == _STATE_ACTIVE, l.IsActive())
+			l.setState(LoggerState(i))
+			assert.Equal(t, l.state == STATE_ACTIVE, l.IsActive())
 		}
 	})
 }
@@ -265,10 +267,10 @@ func Test_Logger_setState(t *testing.T) {
 	rng := 255
 	t.Run("only_valid_from_255", func(t *testing.T) {
 		for i := range rng {
-			l.setState(lgrState(i))
-			res := lgrState(i)
+			l.setState(LoggerState(i))
+			res := LoggerState(i)
 			if res >= _STATE_MAX_for_checks_only {
-				res = _STATE_UNKNOWN
+				res = STATE_UNKNOWN
 			}
 			assert.Equal(t, res, l.state)
 		}
@@ -280,7 +282,7 @@ func Test_Logger_Start(t *testing.T) {
 		l := Init()
 		err := l.Start(0)
 		assert.Nil(t, err, "error on normal start")
-		assert.Equal(t, _STATE_ACTIVE, l.state, "wrong state after normal start")
+		assert.Equal(t, STATE_ACTIVE, l.state, "wrong state after normal start")
 		l.StopAndWait()
 	})
 	t.Run("double", func(t *testing.T) {
@@ -290,7 +292,7 @@ func Test_Logger_Start(t *testing.T) {
 		err = l.Start(0)
 		assert.NotNil(t, err, "no error on double start")
 		assert.EqualError(t, err, _ERROR_MESSAGE_LOGGER_STARTED, "wrong error on double start")
-		assert.Equal(t, _STATE_ACTIVE, l.state, "wrong state after double start")
+		assert.Equal(t, STATE_ACTIVE, l.state, "wrong state after double start")
 		l.StopAndWait()
 	})
 	t.Run("negative_buffsize", func(t *testing.T) {
@@ -307,7 +309,7 @@ func Test_Logger_Stop(t *testing.T) {
 		err := l.Start(0)
 		assert.Nil(t, err, "error on start")
 		l.Stop()
-		assert.Equal(t, _STATE_STOPPING, l.state, "wrong state after stop")
+		assert.Equal(t, STATE_STOPPING, l.state, "wrong state after stop")
 	})
 	t.Run("double", func(t *testing.T) {
 		l := Init()
@@ -319,7 +321,7 @@ func Test_Logger_Stop(t *testing.T) {
 	t.Run("without_start", func(t *testing.T) {
 		l := Init()
 		l.Stop()
-		assert.Equal(t, _STATE_STOPPED, l.state, "wrong state after stop without start")
+		assert.Equal(t, STATE_STOPPED, l.state, "wrong state after stop without start")
 	})
 }
 
@@ -330,12 +332,12 @@ func Test_Logger_Wait(t *testing.T) {
 		assert.Nil(t, err, "error on start")
 		l.Stop()
 		assert.NotPanics(t, func() { l.Wait() }, "Panic on wait after stop")
-		assert.Equal(t, _STATE_STOPPED, l.state, "wrong state after wait")
+		assert.Equal(t, STATE_STOPPED, l.state, "wrong state after wait")
 	})
 	t.Run("without_start", func(t *testing.T) {
 		l := Init()
 		assert.NotPanics(t, func() { l.Wait() }, "Panic on wait without start")
-		assert.Equal(t, _STATE_STOPPED, l.state, "wrong state after wait without start")
+		assert.Equal(t, STATE_STOPPED, l.state, "wrong state after wait without start")
 	})
 	t.Run("double_wait", func(t *testing.T) {
 		l := Init()
@@ -344,7 +346,7 @@ func Test_Logger_Wait(t *testing.T) {
 		l.Stop()
 		assert.NotPanics(t, func() { l.Wait() }, "Panic on first wait")
 		assert.NotPanics(t, func() { l.Wait() }, "Panic on second wait")
-		assert.Equal(t, _STATE_STOPPED, l.state, "wrong state after double wait")
+		assert.Equal(t, STATE_STOPPED, l.state, "wrong state after double wait")
 	})
 	t.Run("wait_long_buff", func(t *testing.T) {
 		buffsize := 8192
@@ -367,12 +369,12 @@ func Test_Logger_StopAndWait(t *testing.T) {
 		err := l.Start(0)
 		assert.Nil(t, err, "error on start")
 		assert.NotPanics(t, func() { l.StopAndWait() }, "Panic on StopAndWait")
-		assert.Equal(t, _STATE_STOPPED, l.state, "wrong state after StopAndWait")
+		assert.Equal(t, STATE_STOPPED, l.state, "wrong state after StopAndWait")
 	})
 	t.Run("without_start", func(t *testing.T) {
 		l := Init()
 		assert.NotPanics(t, func() { l.StopAndWait() }, "Panic on StopAndWait without start")
-		assert.Equal(t, _STATE_STOPPED, l.state, "wrong state after StopAndWait without start")
+		assert.Equal(t, STATE_STOPPED, l.state, "wrong state after StopAndWait without start")
 	})
 	t.Run("double_StopAndWait", func(t *testing.T) {
 		l := Init()
@@ -380,10 +382,79 @@ func Test_Logger_StopAndWait(t *testing.T) {
 		assert.Nil(t, err, "error on start")
 		assert.NotPanics(t, func() { l.StopAndWait() }, "Panic on first StopAndWait")
 		assert.NotPanics(t, func() { l.StopAndWait() }, "Panic on second StopAndWait")
-		assert.Equal(t, _STATE_STOPPED, l.state, "wrong state after double StopAndWait")
+		assert.Equal(t, STATE_STOPPED, l.state, "wrong state after double StopAndWait")
 	})
 }
 
+func Test_Logger_Restart(t *testing.T) {
+	t.Run("normal", func(t *testing.T) {
+		out := &FakeWriter{}
+		l := InitWithParams(LVL_UNKNOWN, &FakeWriter{}, out)
+		lc := l.NewClient("")
+		l.Restart(4)
+		assert.Equal(t, STATE_ACTIVE, l.state, "inactive logger is not started")
+		lc.LogInfo("a")
+		old := l.channel
+		l.Restart(16)
+		assert.Equal(t, STATE_ACTIVE, l.state, "wrong state after restart")
+		assert.Equal(t, 16, cap(l.channel))
+		assert.NotEqual(t, old, l.channel, "channel is not replaced")
+		lc.LogInfo("b")
+		l.StopAndWait()
+		assert.Equal(t, STATE_STOPPED, l.state, "wrong state after stop")
+		assert.Equal(t, ":a\n:b\n", out.String())
+	})
+	t.Run("stopping", func(t *testing.T) {
+		out := NewGateWriter()
+		l := InitWithParams(LVL_UNKNOWN, &FakeWriter{}, out)
+		lc := l.NewClient("")
+		l.Start(4)
+		lc.LogInfo("a")
+		lc.LogInfo("b")
+		l.Stop()
+		assert.Equal(t, STATE_STOPPING, l.state)
+		assert.NoError(t, l.Start(4), "error on start while stopping")
+		lc.LogInfo("c")
+		out.Open()
+		l.StopAndWait()
+		assert.Equal(t, STATE_STOPPED, l.state, "wrong state after stop")
+		assert.Equal(t, ":a\n:b\n:c\n", out.String(), "messages are reordered")
+	})
+}
+
+func Test_Logger_Restart_Concurrent(t *testing.T) {
+	const workers, count = 8, 500
+	out := &FakeWriter{}
+	l := InitWithParams(LVL_UNKNOWN, &FakeWriter{}, out)
+	l.Start(4)
+	var wg sync.WaitGroup
+	for i := range workers {
+		lc := l.NewClient(strconv.Itoa(i))
+		wg.Go(func() {
+			for j := range count {
+				_, err := lc.Log_with_err(LVL_INFO, strconv.Itoa(j))
+				assert.NoError(t, err)
+			}
+		})
+	}
+	for i := range 20 {
+		l.Restart(1 + i%5)
+	}
+	wg.Wait()
+	l.StopAndWait()
+
+	next := make([]int, workers)
+	for line := range strings.SplitSeq(strings.TrimSuffix(out.String(), "\n"), "\n") {
+		name, num, _ := strings.Cut(line, ":")
+		i, _ := strconv.Atoi(name)
+		assert.Equal(t, strconv.Itoa(next[i]), num, "message is lost or reordered")
+		next[i]++
+	}
+	for i := range workers {
+		assert.Equal(t, count, next[i], "messages are lost")
+	}
+}
+
 func Test_Logger_InitWithParams(t *testing.T) {
 	t.Run("normal", func(t *testing.T) {
 		fallbck := io.Discard
@@ -391,7 +462,7 @@ func Test_Logger_InitWithParams(t *testing.T) {
 		out2 := os.Stdout
 		level := LVL_DEBUG
 		l := InitWithParams(level, fallbck, out1, out2)
-		assert.Equal(t, _STATE_STOPPED, l.state, "wrong state after init")
+		assert.Equal(t, STATE_STOPPED, l.state, "wrong state after init")
 		assert.Equal(t, level, l.level, "wrong level after init")
 		assert.Equal(t, 2, len(l.outputs), "wrong outputs count after init")
 		assert.Contains(t, l.outputs, out1, "missing output1 after init")
@@ -403,7 +474,7 @@ func Test_Logger_InitWithParams(t *testing.T) {
 		out2 := io.Discard
 		level := _LVL_MAX_for_checks_only + 10
 		l := InitWithParams(level, nil, nil, out1, nil, out2)
-		assert.Equal(t, _STATE_STOPPED, l.state, "wrong state after init")
+		assert.Equal(t, STATE_STOPPED, l.state, "wrong state after init")
 		assert.Equal(t, LVL_UNKNOWN, l.level, "wrong level after init")
 		assert.Equal(t, 2, len(l.outputs), "wrong outputs count after init")
 		assert.Contains(t, l.outputs, out1, "missing output1 after init")
@@ -422,7 +493,7 @@ func Test_Logger_Init(t *testing.T) {
 			l.Start(0)
 			l.StopAndWait()
 		})
-		assert.Equal(t, _STATE_STOPPED, l.state, "wrong state")
+		assert.Equal(t, STATE_STOPPED, l.state, "wrong state")
 		assert.Equal(t, DEFAULT_LOG_LEVEL, l.level, "wrong log level")
 		assert.Equal(t, 1, len(l.outputs), "wrong outputs count")
 		assert.Contains(t, l.outputs, out1, "wrong output")
@@ -460,7 +531,7 @@ func Test_Logger_InitAndStart(t *testing.T) {
 			l = InitAndStart(DEFAULT_MSG_BUFF, out1)
 		})
 		assert.Equal(t, DEFAULT_MSG_BUFF, cap(l.channel))
-		assert.Equal(t, _STATE_ACTIVE, l.state, "wrong active state")
+		assert.Equal(t, STATE_ACTIVE, l.state, "wrong active state")
 		assert.Equal(t, DEFAULT_LOG_LEVEL, l.level, "wrong log level")
 		assert.Equal(t, 1, len(l.outputs), "wrong outputs count")
 		assert.Contains(t, l.outputs, out1, "wrong output")
@@ -468,7 +539,7 @@ func Test_Logger_InitAndStart(t *testing.T) {
 		assert.NotPanics(t, func() {
 			l.StopAndWait()
 		})
-		assert.Equal(t, _STATE_STOPPED, l.state, "wrong stopped state")
+		assert.Equal(t, STATE_STOPPED, l.state, "wrong stopped state")
 	})
 	t.Run("min_params", func(t *testing.T) {
 		var l *Logger
@@ -476,14 +547,14 @@ func Test_Logger_InitAndStart(t *testing.T) {
 			l = InitAndStart(-1)
 		})
 		assert.Equal(t, DEFAULT_MSG_BUFF, cap(l.channel))
-		assert.Equal(t, _STATE_ACTIVE, l.state, "wrong active state")
+		assert.Equal(t, STATE_ACTIVE, l.state, "wrong active state")
 		assert.Equal(t, DEFAULT_LOG_LEVEL, l.level, "wrong log level")
 		assert.Empty(t, l.outputs, "outputs exist")
 		assert.Equal(t, os.Stderr, l.fallbck, "wrong fallback")
 		assert.NotPanics(t, func() {
 			l.StopAndWait()
 		})
-		assert.Equal(t, _STATE_STOPPED, l.state, "wrong stopped state")
+		assert.Equal(t, STATE_STOPPED, l.state, "wrong stopped state")
 	})
 }
 
@@ -648,14 +719,14 @@ func Test_Logger_pushMessage(t *testing.T) {
 		msg     *logMessage
 		started bool
 		nilchan bool
-		state   lgrState
+		state   LoggerState
 		wantErr string
 	}{
-		{"msg_txt", textmsg, true, false, _STATE_ACTIVE, ""},
-		{"msg_nil", nil, true, false, _STATE_ACTIVE, _ERROR_MESSAGE_LOG_MSG_IS_NIL},
-		{"not-started", textmsg, false, false, _STATE_UNKNOWN, _ERROR_MESSAGE_LOGGER_INACTIVE},
-		{"channel_nil", textmsg, true, true, _STATE_ACTIVE, _ERROR_MESSAGE_CHANNEL_IS_NIL},
-		{"msg_cmd", &logMessage{msgtype: _MSG_COMMAND, annex: basetype(_CMD_DUMMY), msgdata: testbytes}, true, false, _STATE_ACTIVE, ""},
+		{"msg_txt", textmsg, true, false, STATE_ACTIVE, ""},
+		{"msg_nil", nil, true, false, STATE_ACTIVE, _ERROR_MESSAGE_LOG_MSG_IS_NIL},
+		{"not-started", textmsg, false, false, STATE_UNKNOWN, _ERROR_MESSAGE_LOGGER_INACTIVE},
+		{"channel_nil", textmsg, true, true, STATE_ACTIVE, _ERROR_MESSAGE_CHANNEL_IS_NIL},
+		{"msg_cmd", &logMessage{msgtype: _MSG_COMMAND, annex: basetype(_CMD_DUMMY), msgdata: testbytes}, true, false, STATE_ACTIVE, ""},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -698,7 +769,7 @@ func Test_Logger_runClientCommand(t *testing.T) {
 	out2 := &FakeWriter{}
 	l1 := Init(out1)
 	l1.SetFallback(ferr1)
-	l1.state = _STATE_ACTIVE
+	l1.state = STATE_ACTIVE
 	lc1 := l1.NewClientWithLevel("lc1", LVL_UNKNOWN)
 	l2 := Init(out2)
 	l2.SetFallback(ferr2)
@@ -813,6 +884,31 @@ func Test_Logger_SetClientMinLevel(t *testing.T) {
 		})
 	}
 }
+func Test_LogClient_Enabled(t *testing.T) {
+	out1, out2 := &FakeWriter{}, &FakeWriter{}
+	l := InitWithParams(LVL_DEBUG, &FakeWriter{})
+	lc := l.NewClientWithLevel("", LVL_DEBUG)
+	assert.False(t, lc.Enabled(LVL_ERROR), "no outputs")
+	l.AddOutputs(out1, out2)
+	l.SetOutputMinLevel(out1, LVL_WARN).SetOutputMinLevel(out2, LVL_INFO)
+	assert.False(t, lc.Enabled(LVL_TRACE), "logger level")
+	assert.False(t, lc.Enabled(LVL_DEBUG), "output levels")
+	assert.True(t, lc.Enabled(LVL_INFO))
+	l.SetOutputEnabled(out2, false)
+	assert.False(t, lc.Enabled(LVL_INFO), "disabled output")
+	assert.True(t, lc.Enabled(LVL_WARN))
+	l.outputs[out2].retry = outRetry{min: time.Second, failed: true}
+	assert.True(t, lc.Enabled(LVL_INFO), "output waiting for a retry")
+	l.SetClientEnabled(lc, false)
+	assert.False(t, lc.Enabled(LVL_ERROR), "disabled client")
+	l.SetClientEnabled(lc, true)
+	lc.minLevel = LVL_ERROR // SetClientMinLevel is queued (the logger is not active)
+	assert.False(t, lc.Enabled(LVL_WARN), "client level")
+	var nilclient *LogClient
+	assert.False(t, nilclient.Enabled(LVL_ERROR))
+	assert.False(t, (&LogClient{}).Enabled(LVL_ERROR), "client without logger")
+}
+
 func Test_LogClient_LogBytes_with_err(t *testing.T) {
 	var msg *logMessage
 	var err error
@@ -1016,7 +1112,7 @@ func Test_LogClient_Log_with_err(t *testing.T) {
 		out1 := &FakeWriter{}
 		assert.NotPanics(t, func() {
 			msg, err = prep(func() {
-				l.state = _STATE_ACTIVE
+				l.state = STATE_ACTIVE
 			}, LVL_INFO, LVL_WARN, ferr, out1)
 		}, "Panic on write")
 		assert.Error(t, err, "no error on log to stopped logger")
@@ -1101,7 +1197,7 @@ func Test_LogClient_LogLevels(t *testing.T) {
 	l.Start(0)
 	tests := []struct {
 		level LogLevel
-		fn    func(string) time.Time
+		fn    func(string, ...Field) time.Time
 	}{
 		{LVL_TRACE, lc.LogTrace},
 		{LVL_DEBUG, lc.LogDebug},
@@ -1190,7 +1286,7 @@ func Test_Logger_SetClientName(t *testing.T) {
 	out2 := &FakeWriter{}
 	l1 := Init(out1)
 	l1.SetFallback(ferr1)
-	l1.state = _STATE_ACTIVE
+	l1.state = STATE_ACTIVE
 	lc1 := l1.NewClientWithLevel("lc1", LVL_UNKNOWN)
 	l2 := Init(out2)
 	l2.SetFallback(ferr2)
@@ -0,0 +1,182 @@
+package lgr
+
+/*
+Prometheus metrics exporter.
+
+Logger.MetricsHandler returns an http.Handler rendering the logger statistics
+(see Stats) in the Prometheus text exposition format (version 0.0.4) using the
+standard library only:
+
+	lgr_up                                       1 if the logger is active
+	lgr_queue_length, lgr_queue_capacity         queue depth vs capacity
+	lgr_messages_{enqueued,filtered,dropped,written}_total{level}
+	lgr_output_enabled{output}                   0 if the output is disabled
+	lgr_output_written_total{output,level}
+	lgr_output_{bytes,errors,panics,timeouts,dropped}_total{output}
+	lgr_processing_latency_seconds{_sum,_count}  summary without quantiles
+	lgr_processing_latency_max_seconds
+
+Outputs are labeled by names (see Logger.SetOutputName) and sorted by them.
+Default names are unique, names set explicitly must be unique too (otherwise
+the output series are duplicated).
+*/
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	_METRICS_PREFIX       = "lgr_"
+	_METRICS_CONTENT_TYPE = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+// Returns an http.Handler writing the logger statistics in the Prometheus text
+// format (see WriteMetrics).
+func (l *Logger) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", _METRICS_CONTENT_TYPE)
+		l.WriteMetrics(w)
+	})
+}
+
+// Writes the logger statistics in the Prometheus text exposition format.
+func (l *Logger) WriteMetrics(w io.Writer) error {
+	s := l.Stats()
+	slices.SortFunc(s.Outputs, func(a, b OutputStats) int { return strings.Compare(a.Name, b.Name) })
+	mw := metricsWriter{w: bufio.NewWriter(w)}
+
+	up := 0.0
+	if l.State() == STATE_ACTIVE {
+		up = 1
+	}
+	mw.header("up", "gauge", "Whether the logger is active (processing messages).")
+	mw.value("up", nil, up)
+	mw.header("queue_length", "gauge", "Number of messages waiting in the queue.")
+	mw.value("queue_length", nil, float64(s.QueueLen))
+	mw.header("queue_capacity", "gauge", "Capacity of the message queue.")
+	mw.value("queue_capacity", nil, float64(s.QueueCap))
+
+	mw.levels("messages_enqueued_total", "Messages accepted to the queue.", &s.Enqueued)
+	mw.levels("messages_filtered_total", "Messages rejected by client or logger level filters.", &s.Filtered)
+	mw.levels("messages_dropped_total", "Messages dropped on queue overflow.", &s.Dropped)
+	mw.levels("messages_written_total", "Successful writes of messages to outputs.", &s.Written)
+
+	mw.header("output_enabled", "gauge", "Whether the output is enabled (0 if disabled, e.g. after a panic).")
+	for i := range s.Outputs {
+		enabled := 0.0
+		if s.Outputs[i].Enabled {
+			enabled = 1
+		}
+		mw.value("output_enabled", []string{"output", s.Outputs[i].Name}, enabled)
+	}
+	mw.header("output_written_total", "counter", "Successful writes of messages to the output.")
+	for i := range s.Outputs {
+		mw.levelValues("output_written_total", []string{"output", s.Outputs[i].Name}, &s.Outputs[i].Written)
+	}
+	outputCounters := []struct {
+		name, help string
+		value      func(o *OutputStats) uint64
+	}{
+		{"output_bytes_total", "Bytes written to the output.", func(o *OutputStats) uint64 { return o.Bytes }},
+		{"output_errors_total", "Write errors of the output (including panics and timeouts).", func(o *OutputStats) uint64 { return o.Errors }},
+		{"output_panics_total", "Write panics of the output.", func(o *OutputStats) uint64 { return o.Panics }},
+		{"output_timeouts_total", "Write timeouts of the output.", func(o *OutputStats) uint64 { return o.Timeouts }},
+		{"output_dropped_total", "Messages dropped on the output async queue overflow.", func(o *OutputStats) uint64 { return o.Dropped }},
+	}
+	for _, c := range outputCounters {
+		mw.header(c.name, "counter", c.help)
+		for i := range s.Outputs {
+			mw.value(c.name, []string{"output", s.Outputs[i].Name}, float64(c.value(&s.Outputs[i])))
+		}
+	}
+
+	mw.header("processing_latency_seconds", "summary", "Time between queuing messages and writing them to outputs.")
+	mw.value("processing_latency_seconds_sum", nil, s.Latency.Total.Seconds())
+	mw.value("processing_latency_seconds_count", nil, float64(s.Latency.Count))
+	mw.header("processing_latency_max_seconds", "gauge", "Max time between queuing a message and writing it to outputs.")
+	mw.value("processing_latency_max_seconds", nil, s.Latency.Max.Seconds())
+	return mw.flush()
+}
+
+// metricsWriter writes metric lines (the first write error is kept by bufio.Writer
+// and returned by flush).
+type metricsWriter struct {
+	w   *bufio.Writer
+	buf []byte
+}
+
+// Writes HELP and TYPE lines of a metric.
+func (mw *metricsWriter) header(name, kind, help string) {
+	mw.buf = append(mw.buf[:0], "# HELP "+_METRICS_PREFIX...)
+	mw.buf = append(mw.buf, name...)
+	mw.buf = append(mw.buf, ' ')
+	mw.buf = append(mw.buf, help...)
+	mw.buf = append(mw.buf, "\n# TYPE "+_METRICS_PREFIX...)
+	mw.buf = append(mw.buf, name...)
+	mw.buf = append(mw.buf, ' ')
+	mw.buf = append(mw.buf, kind...)
+	mw.buf = append(mw.buf, '\n')
+	mw.w.Write(mw.buf)
+}
+
+// Writes a sample line, labels are key/value pairs.
+func (mw *metricsWriter) value(name string, labels []string, v float64) {
+	mw.buf = append(mw.buf[:0], _METRICS_PREFIX...)
+	mw.buf = append(mw.buf, name...)
+	if len(labels) > 0 {
+		mw.buf = append(mw.buf, '{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				mw.buf = append(mw.buf, ',')
+			}
+			mw.buf = append(mw.buf, labels[i]...)
+			mw.buf = append(mw.buf, '=', '"')
+			mw.buf = appendLabelValue(mw.buf, labels[i+1])
+			mw.buf = append(mw.buf, '"')
+		}
+		mw.buf = append(mw.buf, '}')
+	}
+	mw.buf = append(mw.buf, ' ')
+	mw.buf = strconv.AppendFloat(mw.buf, v, 'g', -1, 64)
+	mw.buf = append(mw.buf, '\n')
+	mw.w.Write(mw.buf)
+}
+
+// Writes a counter with a sample per level.
+func (mw *metricsWriter) levels(name, help string, counts *LevelCounts) {
+	mw.header(name, "counter", help)
+	mw.levelValues(name, nil, counts)
+}
+
+// Writes a sample per level with the level label added to labels.
+func (mw *metricsWriter) levelValues(name string, labels []string, counts *LevelCounts) {
+	labels = append(slices.Clip(labels), "level", "")
+	for level, v := range counts {
+		labels[len(labels)-1] = LevelFullNames[level]
+		mw.value(name, labels, float64(v))
+	}
+}
+
+func (mw *metricsWriter) flush() error {
+	return mw.w.Flush()
+}
+
+// Appends a label value with escaped backslashes, double quotes and line feeds.
+func appendLabelValue(dst []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\', '"':
+			dst = append(dst, '\\', c)
+		case '\n':
+			dst = append(dst, '\\', 'n')
+		default:
+			dst = append(dst, c)
+		}
+	}
+	return dst
+}
@@ -0,0 +1,95 @@
+package lgr
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_defaultOutputName(t *testing.T) {
+	assert.Equal(t, os.Stdout.Name(), defaultOutputName(os.Stdout, 1))
+	assert.Equal(t, "output7", defaultOutputName(&FakeWriter{}, 7))
+	l := Init(os.Stderr, &FakeWriter{})
+	names := []string{}
+	for _, o := range l.Stats().Outputs {
+		names = append(names, o.Name)
+	}
+	assert.ElementsMatch(t, []string{os.Stderr.Name(), "output2"}, names)
+	stdout2 := os.NewFile(os.Stdout.Fd(), os.Stdout.Name())
+	l = Init(os.Stdout, stdout2, &FakeWriter{})
+	l.AddOutputs(os.Stdout) // re-added output keeps its name
+	assert.Equal(t, os.Stdout.Name(), l.getContext(os.Stdout).name)
+	assert.Equal(t, os.Stdout.Name()+"#2", l.getContext(stdout2).name, "duplicated name")
+}
+
+func Test_Logger_SetOutputName(t *testing.T) {
+	out := &FakeWriter{}
+	l := Init(out)
+	l.SetOutputName(out, "main")
+	assert.Equal(t, "main", l.getContext(out).name)
+	l.SetOutputName(&FakeWriter{}, "none") // no panic for unknown output
+}
+
+func Test_appendLabelValue(t *testing.T) {
+	assert.Equal(t, `a\\b\"c\nd`, string(appendLabelValue(nil, "a\\b\"c\nd")))
+}
+
+func Test_Logger_MetricsHandler(t *testing.T) {
+	out, outpanic := &FakeWriter{}, &PanicWriter{}
+	l := InitWithParams(LVL_INFO, &FakeWriter{}, out, outpanic)
+	l.SetOutputName(out, `main "file"`)
+	l.SetOutputName(outpanic, "broken")
+	lc := l.NewClient("c")
+	l.Start(8)
+	lc.LogDebug("filtered")
+	lc.LogInfo("info")
+	lc.LogError("error")
+	l.StopAndWait()
+
+	rec := httptest.NewRecorder()
+	l.MetricsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, _METRICS_CONTENT_TYPE, rec.Header().Get("Content-Type"))
+	body := rec.Body.String()
+	for _, line := range []string{
+		"# TYPE lgr_up gauge",
+		"lgr_up 0",
+		"lgr_queue_length 0",
+		"lgr_queue_capacity 8",
+		"# TYPE lgr_messages_enqueued_total counter",
+		`lgr_messages_enqueued_total{level="INFO"} 1`,
+		`lgr_messages_enqueued_total{level="ERROR"} 1`,
+		`lgr_messages_filtered_total{level="DEBUG"} 1`,
+		`lgr_messages_dropped_total{level="INFO"} 0`,
+		`lgr_messages_written_total{level="INFO"} 1`,
+		`lgr_output_enabled{output="broken"} 0`,
+		`lgr_output_enabled{output="main \"file\""} 1`,
+		`lgr_output_written_total{output="main \"file\"",level="ERROR"} 1`,
+		`lgr_output_bytes_total{output="main \"file\""} ` + strconv.Itoa(len(out.buffer)),
+		`lgr_output_errors_total{output="broken"} 1`,
+		`lgr_output_panics_total{output="broken"} 1`,
+		"# TYPE lgr_processing_latency_seconds summary",
+		"lgr_processing_latency_seconds_count 2",
+		"# TYPE lgr_processing_latency_max_seconds gauge",
+	} {
+		assert.Contains(t, body, "\n"+line+"\n", "no line in metrics")
+	}
+	// outputs are sorted by name
+	assert.Less(t, strings.Index(body, `lgr_output_enabled{output="broken"}`), strings.Index(body, `lgr_output_enabled{output="main`))
+	// every sample line is `name{labels} value`
+	for _, line := range strings.Split(strings.TrimSuffix(body, "\n"), "\n") {
+		if !strings.HasPrefix(line, "#") {
+			assert.True(t, strings.HasPrefix(line, _METRICS_PREFIX), line)
+			assert.Len(t, strings.Fields(line[strings.LastIndexByte(line, ' '):]), 1, line)
+		}
+	}
+}
+
+func Test_Logger_WriteMetrics_Error(t *testing.T) {
+	assert.Error(t, Init().WriteMetrics(&ErrorWriter{}))
+}
@@ -0,0 +1,292 @@
+package lgr
+
+/*
+Message queue overflow handling.
+
+By default pushMessage blocks the caller until there is room in the logger
+channel, so a slow output stalls every logging goroutine. The overflow policy
+of a logger allows to lose messages instead of waiting:
+  - OVERFLOW_BLOCK: wait for free space (default)
+  - OVERFLOW_DROP_NEWEST: the message being queued is dropped
+  - OVERFLOW_DROP_OLDEST: the oldest queued messages are dropped to make room
+    (while the queue holds protected messages the new one is dropped instead,
+    as the queue order is never changed)
+  - OVERFLOW_BLOCK_TIMEOUT: wait up to the timeout, then drop the message
+
+Commands and messages of guaranteed levels (ERROR and above by default) are
+never dropped: they always wait for free space, and a part of the queue is
+reserved for them, so they rarely have to wait. Low-priority messages (below
+INFO by default) may use only half of the rest of the queue, so they are shed
+first (see Logger.SetOverflowPriority).
+
+Dropped messages are counted, and the processing goroutine writes a notice with
+the number of dropped messages to the outputs once the queue is at most half
+full.
+*/
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+type OverflowPolicy basetype // Logger queue overflow policy (alias for byte)
+
+const (
+	// Queue overflow policies (see Logger.SetOverflowPolicy).
+	OVERFLOW_BLOCK         OverflowPolicy = iota // wait for free space in the queue
+	OVERFLOW_DROP_NEWEST                         // drop the message being queued
+	OVERFLOW_DROP_OLDEST                         // drop the oldest queued messages
+	OVERFLOW_BLOCK_TIMEOUT                       // wait up to the timeout, then drop the message
+	_OVERFLOW_MAX_for_checks_only
+)
+
+const (
+	// Default overflow priority settings (see Logger.SetOverflowPriority)
+	DEFAULT_GUARANTEED_LEVEL = LVL_ERROR // messages of this level and above are never dropped
+	DEFAULT_SHED_LEVEL       = LVL_INFO  // messages below this level are dropped first
+	DEFAULT_QUEUE_RESERVE    = 25        // percent of the queue reserved for guaranteed messages
+
+	_ERROR_MESSAGE_MSG_DROPPED = "log message dropped on queue overflow"
+	_DROPPED_NOTICE_SUFFIX     = " log messages dropped on queue overflow"
+	_DROPPED_NOTICE_LEVEL      = LVL_ERROR // visible with the default logger level
+)
+
+// ErrMessageDropped is returned by Log*_with_err methods when the message is
+// dropped by the logger overflow policy. Simple Log* methods don't write this
+// error to the fallback (drops are counted and reported by the notice).
+var ErrMessageDropped = errors.New(_ERROR_MESSAGE_MSG_DROPPED)
+
+// Sets the logger queue overflow policy. The timeout is used only by
+// [OVERFLOW_BLOCK_TIMEOUT] (non-positive timeout means drop without waiting).
+// Unknown policies are replaced with [OVERFLOW_BLOCK].
+//
+// The operation is protected by mutex for thread safety.
+func (l *Logger) SetOverflowPolicy(policy OverflowPolicy, timeout time.Duration) *Logger {
+	l.sync.chngMtx.Lock()
+	defer l.sync.chngMtx.Unlock()
+	l.overflow.policy = norm_byte(policy, _OVERFLOW_MAX_for_checks_only, OVERFLOW_BLOCK)
+	l.overflow.timeout = max(timeout, 0)
+	return l
+}
+
+// Sets the priority of log levels on queue overflow (used by all policies except
+// [OVERFLOW_BLOCK]):
+//   - guaranteed: messages of this level and above are never dropped (they wait
+//     for free space like with [OVERFLOW_BLOCK]), [LVL_UNKNOWN] protects all levels
+//   - shed: messages below this level are dropped first (they may use only half
+//     of the non-reserved queue and never push out other messages)
+//   - reserve: percent of the queue capacity reserved for guaranteed messages and
+//     commands (clamped to 0..100)
+//
+// The operation is protected by mutex for thread safety.
+func (l *Logger) SetOverflowPriority(guaranteed, shed LogLevel, reserve int) *Logger {
+	l.sync.chngMtx.Lock()
+	defer l.sync.chngMtx.Unlock()
+	l.overflow.guaranteed = normLevel(guaranteed)
+	l.overflow.shedlevel = normLevel(shed)
+	l.overflow.reserve = min(max(reserve, 0), 100)
+	return l
+}
+
+// Returns the logger queue overflow policy and timeout.
+func (l *Logger) OverflowPolicy() (OverflowPolicy, time.Duration) {
+	l.sync.chngMtx.RLock()
+	defer l.sync.chngMtx.RUnlock()
+	return l.overflow.policy, l.overflow.timeout
+}
+
+// Returns the total number of messages dropped on queue overflow.
+func (l *Logger) DroppedMessages() uint64 {
+	return l.overflow.dropped.Load()
+}
+
+// Sends a message to the channel according to the overflow policy. Must be called
+// with the state read lock held (so the channel can't be closed meanwhile).
+//
+// Protected messages (commands and guaranteed levels) always wait for free space.
+// Other messages may use only a part of the queue (see queueLimit).
+func (l *Logger) sendMessage(msg *logMessage) error {
+	policy, timeout := l.OverflowPolicy()
+	if l.isProtected(msg) {
+		msg.protect = true
+		l.channel <- *msg
+		l.overflow.protected.Add(1)
+		return nil
+	}
+	if policy == OVERFLOW_BLOCK {
+		l.channel <- *msg
+		return nil
+	}
+	limit := l.queueLimit(LogLevel(msg.annex))
+	if l.trySend(msg, limit) {
+		return nil
+	}
+	switch policy {
+	case OVERFLOW_DROP_OLDEST:
+		if LogLevel(msg.annex) < l.overflowShedLevel() {
+			// low-priority messages never push out other ones
+			break
+		}
+		// bounded by the queue capacity (other producers may take the freed slots)
+		for range cap(l.channel) {
+			if l.overflow.protected.Load() > 0 {
+				// the oldest message may be protected: drop the new one instead
+				break
+			}
+			if !l.evictOldest() {
+				// a protected message became the oldest meanwhile
+				l.channel <- *msg
+				return nil
+			}
+			if l.trySend(msg, limit) {
+				return nil
+			}
+		}
+	case OVERFLOW_BLOCK_TIMEOUT:
+		if timeout > 0 {
+			if err := l.waitRoom(msg, timeout); err != ErrMessageDropped {
+				return err
+			}
+		}
+	}
+	l.countDropped(msg)
+	return ErrMessageDropped
+}
+
+// Waits up to the timeout for the queue length to get below the limit of the message
+// level and sends the message (ErrMessageDropped is returned on timeout). The
+// processing goroutine signals every received message while there are waiters (see
+// signalRoom), so the queue isn't polled. The state read lock is released while
+// waiting, so the logger can be stopped or restarted meanwhile.
+func (l *Logger) waitRoom(msg *logMessage, timeout time.Duration) error {
+	l.overflow.waiters.Add(1)
+	defer l.overflow.waiters.Add(-1)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		l.sync.statMtx.RUnlock()
+		timedout := false
+		select {
+		case <-l.overflow.room:
+		case <-timer.C:
+			timedout = true
+		}
+		l.sync.statMtx.RLock()
+		switch {
+		case !l.IsActive():
+			l.signalRoom() // wake up other waiters too
+			return errors.New(_ERROR_MESSAGE_LOGGER_INACTIVE)
+		case timedout:
+			return ErrMessageDropped
+		}
+		limit := l.queueLimit(LogLevel(msg.annex))
+		if l.trySend(msg, limit) {
+			if len(l.channel) < limit {
+				// pass the signal on to other waiters
+				l.signalRoom()
+			}
+			return nil
+		}
+	}
+}
+
+// Wakes up a caller waiting for room in the queue (if any).
+func (l *Logger) signalRoom() {
+	if l.overflow.waiters.Load() > 0 {
+		select {
+		case l.overflow.room <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Removes the oldest queued message counting it as dropped. Returns false if the
+// message is protected (it can be queued after the protected messages counter is
+// checked, if the queue is drained meanwhile): such a message is passed to the
+// processing goroutine to be proceeded before the rest of the queue.
+func (l *Logger) evictOldest() bool {
+	l.overflow.evictMtx.Lock()
+	defer l.overflow.evictMtx.Unlock()
+	select {
+	case old := <-l.channel:
+		if old.protect {
+			l.overflow.rescued = append(l.overflow.rescued, old)
+			return false
+		}
+		l.countDropped(&old)
+	default:
+		// the queue is drained by the processing goroutine meanwhile
+	}
+	return true
+}
+
+// Returns the messages taken by evictOldest before the message received by the
+// processing goroutine (called by the processing goroutine only, after each receive).
+func (l *Logger) takeRescued() []logMessage {
+	l.overflow.evictMtx.Lock()
+	defer l.overflow.evictMtx.Unlock()
+	rescued := l.overflow.rescued
+	l.overflow.rescued = nil
+	return rescued
+}
+
+// Sends a message without blocking if the queue length is below the limit.
+func (l *Logger) trySend(msg *logMessage, limit int) bool {
+	if len(l.channel) >= limit {
+		return false
+	}
+	select {
+	case l.channel <- *msg:
+		return true
+	default:
+		return false
+	}
+}
+
+// Returns whether the message is never dropped on overflow (commands and messages
+// of guaranteed levels).
+func (l *Logger) isProtected(msg *logMessage) bool {
+	if msg.msgtype == _MSG_COMMAND {
+		return true
+	}
+	l.sync.chngMtx.RLock()
+	defer l.sync.chngMtx.RUnlock()
+	return LogLevel(msg.annex) >= l.overflow.guaranteed
+}
+
+// Returns the min level of messages that are not dropped first.
+func (l *Logger) overflowShedLevel() LogLevel {
+	l.sync.chngMtx.RLock()
+	defer l.sync.chngMtx.RUnlock()
+	return l.overflow.shedlevel
+}
+
+// Returns the number of queue slots available to non-protected messages of the
+// level: the queue capacity without the reserved part, and half of that for the
+// levels shed first (at least one slot anyway).
+func (l *Logger) queueLimit(level LogLevel) int {
+	l.sync.chngMtx.RLock()
+	defer l.sync.chngMtx.RUnlock()
+	capacity := cap(l.channel)
+	limit := max(capacity-capacity*l.overflow.reserve/100, 1)
+	if level < l.overflow.shedlevel {
+		limit = (limit + 1) / 2
+	}
+	return limit
+}
+
+// Writes the notice about messages dropped since the previous notice to the outputs
+// (called by the processing goroutine only). With force false the notice is written
+// only if the queue (the channel being processed) is at most half full.
+func (l *Logger) reportDropped(queue chan logMessage, force bool) {
+	if l.overflow.unreported.Load() == 0 || (!force && len(queue) > cap(queue)/2) {
+		return
+	}
+	n := l.overflow.unreported.Swap(0)
+	msg := makeTextMessage(nil, _DROPPED_NOTICE_LEVEL, []byte(strconv.FormatUint(n, 10)+_DROPPED_NOTICE_SUFFIX))
+	msg.pushed = time.Now()
+	if err := l.proceedMsg(msg); err != nil {
+		l.fbckWriteln("error proceeding message: " + err.Error())
+	}
+}
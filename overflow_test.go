@@ -0,0 +1,305 @@
+package lgr
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Returns an active logger with the channel of the specified size but without
+// the processing goroutine (the queue is filled deterministically).
+func newStalledLogger(size int, policy OverflowPolicy, timeout time.Duration, outputs ...OutType) *Logger {
+	l := InitWithParams(LVL_UNKNOWN, &FakeWriter{}, outputs...)
+	l.SetOverflowPolicy(policy, timeout)
+	l.SetOverflowPriority(DEFAULT_GUARANTEED_LEVEL, DEFAULT_SHED_LEVEL, 0) // no reserve unless set by test
+	l.channel = make(chan logMessage, size)
+	l.state = STATE_ACTIVE
+	return l
+}
+
+// Returns data of the queued messages (the channel is drained).
+func drainQueue(l *Logger) (res []string) {
+	for len(l.channel) > 0 {
+		msg := <-l.channel
+		res = append(res, string(msg.msgdata))
+	}
+	return res
+}
+
+func Test_Logger_SetOverflowPolicy(t *testing.T) {
+	l := Init()
+	p, d := l.OverflowPolicy()
+	assert.Equal(t, OVERFLOW_BLOCK, p, "wrong default policy")
+	assert.Zero(t, d)
+	l.SetOverflowPolicy(OVERFLOW_BLOCK_TIMEOUT, time.Second)
+	p, d = l.OverflowPolicy()
+	assert.Equal(t, OVERFLOW_BLOCK_TIMEOUT, p)
+	assert.Equal(t, time.Second, d)
+	l.SetOverflowPolicy(_OVERFLOW_MAX_for_checks_only+1, -time.Second)
+	p, d = l.OverflowPolicy()
+	assert.Equal(t, OVERFLOW_BLOCK, p, "unknown policy is not normalized")
+	assert.Zero(t, d, "negative timeout is kept")
+}
+
+func Test_Logger_sendMessage(t *testing.T) {
+	t.Run("drop_newest", func(t *testing.T) {
+		l := newStalledLogger(2, OVERFLOW_DROP_NEWEST, 0)
+		lc := l.NewClient("")
+		for _, s := range []string{"a", "b", "c", "d"} {
+			lc.LogInfo(s)
+		}
+		_, err := lc.Log_with_err(LVL_INFO, "e")
+		assert.ErrorIs(t, err, ErrMessageDropped)
+		assert.Equal(t, []string{"a", "b"}, drainQueue(l))
+		assert.Equal(t, uint64(3), l.DroppedMessages())
+		assert.Empty(t, l.fallbck.(*FakeWriter).buffer, "dropped message is reported to fallback")
+	})
+	t.Run("drop_oldest", func(t *testing.T) {
+		l := newStalledLogger(2, OVERFLOW_DROP_OLDEST, 0)
+		lc := l.NewClient("")
+		for _, s := range []string{"a", "b", "c", "d"} {
+			_, err := lc.Log_with_err(LVL_INFO, s)
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, []string{"c", "d"}, drainQueue(l))
+		assert.Equal(t, uint64(2), l.DroppedMessages())
+	})
+	t.Run("drop_oldest_command", func(t *testing.T) {
+		l := newStalledLogger(2, OVERFLOW_DROP_OLDEST, 0)
+		lc := l.NewClient("")
+		l.SetClientName(lc, "cmd")
+		lc.LogInfo("a")
+		lc.LogInfo("b")
+		assert.Equal(t, []string{"cmd", "a"}, drainQueue(l), "command is dropped or reordered")
+		assert.Equal(t, uint64(1), l.DroppedMessages())
+	})
+	t.Run("drop_oldest_protected_head", func(t *testing.T) {
+		l := newStalledLogger(3, OVERFLOW_DROP_OLDEST, 0)
+		lc := l.NewClient("")
+		lc.LogError("E1")
+		for _, s := range []string{"a", "b", "c", "d"} {
+			lc.LogInfo(s)
+		}
+		assert.Equal(t, []string{"E1", "a", "b"}, drainQueue(l), "queue is reordered")
+		assert.Equal(t, uint64(2), l.DroppedMessages())
+	})
+	t.Run("drop_oldest_rescued", func(t *testing.T) {
+		// a protected message not counted yet (queued concurrently)
+		out := &FakeWriter{}
+		l := newStalledLogger(2, OVERFLOW_DROP_OLDEST, 0, out)
+		l.channel <- logMessage{msgtype: _MSG_LOG_TEXT, msgdata: []byte("E"), annex: basetype(LVL_ERROR), protect: true}
+		l.channel <- logMessage{msgtype: _MSG_LOG_TEXT, msgdata: []byte("a"), annex: basetype(LVL_INFO)}
+		assert.False(t, l.evictOldest(), "protected message is evicted")
+		assert.Zero(t, l.DroppedMessages())
+		l.channel <- logMessage{msgtype: _MSG_LOG_TEXT, msgdata: []byte("b"), annex: basetype(LVL_INFO)}
+		l.Stop()
+		l.procced(l.channel)
+		assert.Equal(t, "E\na\nb\n", out.String(), "rescued message is not proceeded first")
+		assert.Empty(t, l.overflow.rescued)
+	})
+	t.Run("block_timeout", func(t *testing.T) {
+		const timeout = 20 * time.Millisecond
+		l := newStalledLogger(1, OVERFLOW_BLOCK_TIMEOUT, timeout)
+		lc := l.NewClient("")
+		lc.LogInfo("a")
+		t0 := time.Now()
+		tm, err := lc.Log_with_err(LVL_INFO, "b")
+		assert.GreaterOrEqual(t, time.Since(t0), timeout, "no wait")
+		assert.ErrorIs(t, err, ErrMessageDropped)
+		assert.Zero(t, tm)
+		go func() {
+			time.Sleep(timeout / 4)
+			<-l.channel
+			l.signalRoom() // as the processing goroutine does
+		}()
+		_, err = lc.Log_with_err(LVL_INFO, "c")
+		assert.NoError(t, err, "message is dropped despite free space")
+		assert.Equal(t, []string{"c"}, drainQueue(l))
+		assert.Equal(t, uint64(1), l.DroppedMessages())
+	})
+	t.Run("block_timeout_stop", func(t *testing.T) {
+		l := newStalledLogger(1, OVERFLOW_BLOCK_TIMEOUT, time.Minute)
+		lc := l.NewClient("")
+		lc.LogInfo("a")
+		res := make(chan error)
+		go func() {
+			_, err := lc.Log_with_err(LVL_INFO, "b")
+			res <- err
+		}()
+		assert.Eventually(t, func() bool { return l.overflow.waiters.Load() == 1 }, time.Second, time.Millisecond)
+		assert.Equal(t, STATE_ACTIVE, l.State(), "state lock is held while waiting")
+		l.Stop()
+		select {
+		case err := <-res:
+			assert.EqualError(t, err, _ERROR_MESSAGE_LOGGER_INACTIVE)
+		case <-time.After(time.Second):
+			t.Fatal("waiting caller is not woken up on stop")
+		}
+	})
+	t.Run("command_never_dropped", func(t *testing.T) {
+		l := newStalledLogger(1, OVERFLOW_DROP_NEWEST, 0)
+		lc := l.NewClient("")
+		lc.LogInfo("a")
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			<-l.channel
+		}()
+		_, err := l.SetClientName(lc, "cmd")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"cmd"}, drainQueue(l))
+		assert.Zero(t, l.DroppedMessages())
+	})
+}
+
+func Test_Logger_reportDropped(t *testing.T) {
+	out := &FakeWriter{}
+	l := newStalledLogger(4, OVERFLOW_DROP_NEWEST, 0, out)
+	lc := l.NewClient("c")
+	for i := range 7 {
+		lc.LogInfo(strings.Repeat("x", i+1))
+	}
+	assert.Equal(t, uint64(3), l.DroppedMessages())
+	// processing after the queue is closed: the notice is written after the
+	// message that makes the queue half-empty
+	l.Stop()
+	l.procced(l.channel)
+	assert.Equal(t, "c:x\nc:xx\n3"+_DROPPED_NOTICE_SUFFIX+"\nc:xxx\nc:xxxx\n", out.String())
+	assert.Equal(t, uint64(3), l.DroppedMessages(), "total counter is changed")
+	assert.Zero(t, l.overflow.unreported.Load())
+	t.Run("on_exit", func(t *testing.T) {
+		out.Clear()
+		l := newStalledLogger(4, OVERFLOW_DROP_NEWEST, 0, out)
+		l.countDropped(&logMessage{})
+		l.Stop()
+		l.procced(l.channel)
+		assert.Equal(t, "1"+_DROPPED_NOTICE_SUFFIX+"\n", out.String())
+	})
+}
+
+func Test_Logger_Overflow_Concurrent(t *testing.T) {
+	for _, policy := range []OverflowPolicy{OVERFLOW_DROP_NEWEST, OVERFLOW_DROP_OLDEST, OVERFLOW_BLOCK_TIMEOUT} {
+		out := &FakeWriter{}
+		l := InitWithParams(LVL_UNKNOWN, &FakeWriter{}, out)
+		l.SetOverflowPolicy(policy, time.Microsecond)
+		l.Start(2)
+		done := make(chan struct{})
+		const count = 1000
+		for range 4 {
+			go func() {
+				lc := l.NewClient("")
+				for range count {
+					lc.LogInfo("x")
+				}
+				done <- struct{}{}
+			}()
+		}
+		for range 4 {
+			<-done
+		}
+		l.StopAndWait()
+		written := strings.Count(out.String(), "x\n")
+		assert.Equal(t, 4*count, written+int(l.DroppedMessages()), "messages are lost without counting")
+	}
+}
+
+func Test_Logger_queueLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		capacity int
+		reserve  int
+		level    LogLevel
+		want     int
+	}{
+		{"no_reserve", 8, 0, LVL_INFO, 8},
+		{"no_reserve_shed", 8, 0, LVL_DEBUG, 4},
+		{"default", 8, DEFAULT_QUEUE_RESERVE, LVL_WARN, 6},
+		{"default_shed", 8, DEFAULT_QUEUE_RESERVE, LVL_TRACE, 3},
+		{"all_reserved", 8, 100, LVL_INFO, 1},
+		{"over_100", 8, 1000, LVL_UNKNOWN, 1},
+		{"tiny", 1, 50, LVL_INFO, 1},
+		{"tiny_shed", 1, 50, LVL_TRACE, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newStalledLogger(tt.capacity, OVERFLOW_DROP_NEWEST, 0)
+			l.SetOverflowPriority(DEFAULT_GUARANTEED_LEVEL, DEFAULT_SHED_LEVEL, tt.reserve)
+			assert.Equal(t, tt.want, l.queueLimit(tt.level))
+		})
+	}
+}
+
+func Test_Logger_OverflowPriority(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		l := Init()
+		assert.Equal(t, DEFAULT_GUARANTEED_LEVEL, l.overflow.guaranteed)
+		assert.Equal(t, DEFAULT_SHED_LEVEL, l.overflow.shedlevel)
+		assert.Equal(t, DEFAULT_QUEUE_RESERVE, l.overflow.reserve)
+		l.SetOverflowPriority(_LVL_MAX_for_checks_only, LVL_WARN, -1)
+		assert.Equal(t, LVL_UNKNOWN, l.overflow.guaranteed)
+		assert.Equal(t, LVL_WARN, l.overflow.shedlevel)
+		assert.Zero(t, l.overflow.reserve)
+	})
+	t.Run("reserve", func(t *testing.T) {
+		l := newStalledLogger(4, OVERFLOW_DROP_NEWEST, 0)
+		l.SetOverflowPriority(LVL_ERROR, LVL_INFO, 50)
+		lc := l.NewClient("")
+		lc.LogDebug("d1")
+		lc.LogDebug("d2") // over 1 slot for shed levels
+		lc.LogInfo("i1")
+		lc.LogInfo("i2") // over 2 non-reserved slots
+		lc.LogError("e1")
+		lc.Log(LVL_FATAL, "e2")
+		assert.Equal(t, []string{"d1", "i1", "e1", "e2"}, drainQueue(l))
+		assert.Equal(t, uint64(2), l.DroppedMessages())
+	})
+	t.Run("guaranteed_waits", func(t *testing.T) {
+		l := newStalledLogger(1, OVERFLOW_DROP_NEWEST, 0)
+		lc := l.NewClient("")
+		lc.LogInfo("a")
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			<-l.channel
+		}()
+		_, err := lc.Log_with_err(LVL_ERROR, "e")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"e"}, drainQueue(l))
+		assert.Zero(t, l.DroppedMessages())
+	})
+	t.Run("drop_oldest", func(t *testing.T) {
+		l := newStalledLogger(2, OVERFLOW_DROP_OLDEST, 0)
+		lc := l.NewClient("")
+		lc.LogError("e")
+		lc.LogInfo("a")
+		lc.LogInfo("b")  // "e" is the oldest: "b" is dropped
+		lc.LogDebug("d") // shed level never pushes out other messages
+		assert.Equal(t, []string{"e", "a"}, drainQueue(l))
+		assert.Equal(t, uint64(2), l.DroppedMessages())
+	})
+	t.Run("drop_oldest_all_protected", func(t *testing.T) {
+		l := newStalledLogger(2, OVERFLOW_DROP_OLDEST, 0)
+		lc := l.NewClient("")
+		lc.LogError("e1")
+		lc.LogError("e2")
+		_, err := lc.Log_with_err(LVL_WARN, "w")
+		assert.ErrorIs(t, err, ErrMessageDropped)
+		assert.Equal(t, []string{"e1", "e2"}, drainQueue(l))
+	})
+	t.Run("timeout_shed", func(t *testing.T) {
+		l := newStalledLogger(4, OVERFLOW_BLOCK_TIMEOUT, 10*time.Millisecond)
+		lc := l.NewClient("")
+		lc.LogInfo("a")
+		lc.LogInfo("b")
+		_, err := lc.Log_with_err(LVL_TRACE, "t") // queue is not full, but over shed limit
+		assert.ErrorIs(t, err, ErrMessageDropped)
+		go func() {
+			time.Sleep(2 * time.Millisecond)
+			<-l.channel
+			l.signalRoom()
+		}()
+		_, err = lc.Log_with_err(LVL_TRACE, "t")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"b", "t"}, drainQueue(l))
+	})
+}
@@ -0,0 +1,96 @@
+package lgr
+
+/*
+Printf-style logging helpers.
+
+Logf and the level-specific LogTracef...LogErrorf check the logger-wide and
+client filtering first, so filtered messages cost no formatting:
+
+	client.LogTracef("cache state: %v", cache.Dump()) // arguments are still evaluated!
+
+Logf_deferred moves formatting to the processing goroutine for arguments of
+basic types (bools, numbers, strings, byte slices, time.Time and time.Duration).
+Formatting of any other argument may call its String, Error or Format method,
+i.e. user code that can log itself, take locks held by the caller or stall the
+processing goroutine, so such messages are formatted by the caller like Logf.
+Deferred byte slices must not be changed after the call, as they are read later
+by another goroutine.
+*/
+
+import (
+	"fmt"
+	"time"
+)
+
+// Formats the message like fmt.Sprintf and logs it at the provided level (see Log).
+// Nothing is formatted if the message is filtered by the logger or client level or
+// the client is disabled.
+func (lc *LogClient) Logf(level LogLevel, format string, args ...any) time.Time {
+	var data []byte
+	if lc.accepts(level) {
+		data = fmt.Appendf(nil, format, args...)
+	}
+	// filtered messages are counted (and errors are reported) as usual
+	return lc.LogBytes(level, data)
+}
+
+// Same as Logf() but the message is formatted by the processing goroutine, so the
+// caller pays only for queuing. Only arguments of basic types are deferred (see
+// deferrable), otherwise the message is formatted by the caller. Byte slices must
+// not be changed after the call.
+func (lc *LogClient) Logf_deferred(level LogLevel, format string, args ...any) time.Time {
+	if !deferrable(args) {
+		return lc.Logf(level, format, args...)
+	}
+	if args == nil {
+		args = []any{}
+	}
+	t, err := lc.logBytes(level, []byte(format), args, nil)
+	if err != nil && err != ErrMessageDropped && lc.logger != nil {
+		lc.logger.handleLogWriteError(err.Error())
+	}
+	return t
+}
+
+// Formats and logs a message at TRACE level (see Logf).
+func (lc *LogClient) LogTracef(format string, args ...any) time.Time {
+	return lc.Logf(LVL_TRACE, format, args...)
+}
+
+// Formats and logs a message at DEBUG level (see Logf).
+func (lc *LogClient) LogDebugf(format string, args ...any) time.Time {
+	return lc.Logf(LVL_DEBUG, format, args...)
+}
+
+// Formats and logs a message at INFO level (see Logf).
+func (lc *LogClient) LogInfof(format string, args ...any) time.Time {
+	return lc.Logf(LVL_INFO, format, args...)
+}
+
+// Formats and logs a message at WARN level (see Logf).
+func (lc *LogClient) LogWarnf(format string, args ...any) time.Time {
+	return lc.Logf(LVL_WARN, format, args...)
+}
+
+// Formats and logs a message at ERROR level (see Logf).
+func (lc *LogClient) LogErrorf(format string, args ...any) time.Time {
+	return lc.Logf(LVL_ERROR, format, args...)
+}
+
+// Reports whether formatting of the arguments calls no user methods (String, Error,
+// Format etc), so it can't reenter the logger from the processing goroutine. Named
+// types are not deferrable even if their underlying types are basic.
+func deferrable(args []any) bool {
+	for _, arg := range args {
+		switch arg.(type) {
+		case nil, bool, string, []byte,
+			int, int8, int16, int32, int64,
+			uint, uint8, uint16, uint32, uint64, uintptr,
+			float32, float64, complex64, complex128,
+			time.Time, time.Duration:
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,62 @@
+package lgr
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countStringer counts formatting calls.
+type countStringer struct {
+	calls *atomic.Int32
+}
+
+func (c countStringer) String() string {
+	c.calls.Add(1)
+	return "str"
+}
+
+func Test_LogClient_Logf(t *testing.T) {
+	out := &FakeWriter{}
+	l := InitWithParams(LVL_DEBUG, &FakeWriter{}, out)
+	l.SetOutputLevelPrefix(out, LevelShortNames, ":")
+	lc := l.NewClient("f")
+	calls := &atomic.Int32{}
+	arg := countStringer{calls}
+	l.Start(16)
+	lc.LogTracef("%v", arg)
+	lc.Logf(LVL_INFO, "%v", arg)
+	assert.Equal(t, int32(1), calls.Load(), "filtered message is formatted")
+	l.SetClientEnabled(lc, false)
+	lc.LogErrorf("%v", arg)
+	l.SetClientEnabled(lc, true)
+	assert.Equal(t, int32(1), calls.Load(), "message of disabled client is formatted")
+
+	lc.LogDebugf("%d-%s", 1, "a")
+	lc.LogInfof("%d", 2)
+	lc.LogWarnf("%s", "w")
+	lc.LogErrorf("no args")
+	lc.Logf_deferred(LVL_INFO, "deferred %v %d", arg, 3)
+	assert.Equal(t, int32(2), calls.Load(), "Stringer argument is not formatted by the caller")
+	lc.Logf_deferred(LVL_INFO, "deferred%%")
+	lc.Logf_deferred(LVL_TRACE, "filtered %v", arg)
+	l.StopAndWait()
+	assert.Equal(t, int32(2), calls.Load())
+	assert.Equal(t, "INF:f:str\nDBG:f:1-a\nINF:f:2\nWRN:f:w\nERR:f:no args\nINF:f:deferred str 3\nINF:f:deferred%\n", out.String())
+	s := l.Stats()
+	assert.Equal(t, uint64(2), s.Filtered[LVL_TRACE], "filtered messages are not counted")
+	assert.Equal(t, uint64(1), s.Filtered[LVL_ERROR])
+}
+
+func Test_deferrable(t *testing.T) {
+	type named int
+	assert.True(t, deferrable(nil))
+	assert.True(t, deferrable([]any{nil, true, "s", []byte("b"), 1, int8(1), uint64(1), 1.5, 1i, time.Now(), time.Second}))
+	assert.False(t, deferrable([]any{1, countStringer{}}), "Stringer")
+	assert.False(t, deferrable([]any{errors.New("e")}), "error")
+	assert.False(t, deferrable([]any{named(1)}), "named type")
+	assert.False(t, deferrable([]any{&struct{}{}}), "pointer")
+}
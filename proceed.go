@@ -1,10 +1,13 @@
 package lgr
 
-// never use fmt in threads!
+// never use fmt in threads! The only exception is formatting of Logf_deferred
+// messages: their arguments are of basic types only (see deferrable), so fmt calls
+// no user methods that could reenter the logger or block.
 
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"strconv"
 	"time"
 )
@@ -43,37 +46,92 @@ func msgDescStr(m *logMessage) string {
 // Sets the logger normalized state.
 //
 // The operation is protected by mutex for thread safety.
-func (l *Logger) setState(newstate lgrState) {
+func (l *Logger) setState(newstate LoggerState) {
 	l.sync.statMtx.Lock()
 	defer l.sync.statMtx.Unlock()
 	l.state = normState(newstate)
 }
 
-// Background message queue and processing loop. It reads messages from the channel
-// until the channel is closed. For each message it calls proceedMsg to perform the
-// appropriate action.
+// Moves the logger to the stopped state when its processing goroutine ends, unless
+// the channel is replaced meanwhile (the logger is restarted). Returns whether the
+// state is changed.
+//
+// The operation is protected by mutex for thread safety.
+func (l *Logger) setStoppedFor(channel chan logMessage) bool {
+	l.sync.statMtx.Lock()
+	defer l.sync.statMtx.Unlock()
+	if l.channel != channel || l.state == STATE_STOPPED {
+		return false
+	}
+	l.state = STATE_STOPPED
+	return true
+}
+
+// Background message queue and processing loop. It reads messages from the provided
+// channel (the logger channel at the start, see Restart) until the channel is
+// closed. For each message it calls proceedMsg to perform the appropriate action.
+// Notices about dropped messages are written once the queue recovers (see
+// reportDropped). Pending batches are written in time (see SetOutputBatching) and
+// on exit. Messages are skipped after the shutdown deadline (see Shutdown).
 //
 // The function recovers panics to ensure the background goroutine doesn't die silently;
-// recover triggers a fallback write and ensures logger is moved to stopped state
-// before returning.
-func (l *Logger) procced() {
+// recover triggers a fallback write and the LIFECYCLE_PANICKED notification before
+// returning (the logger is moved to stopped state by the goroutine launched in Start).
+func (l *Logger) procced(channel chan logMessage) {
 	l.msgbuf = bytes.NewBuffer(make([]byte, DEFAULT_OUT_BUFF))
 	defer func() {
 		if r := recover(); r != nil {
 			l.fbckWriteln("panic proceeding log" + panicDesc(r))
+			l.notifyLifecycle(LIFECYCLE_PANICKED, errors.New("panic proceeding log"+panicDesc(r)))
 		}
 		l.msgbuf = nil
-		l.setState(_STATE_STOPPED)
 	}()
 	for {
-		msg, opened := <-l.channel
+		var msg logMessage
+		opened := true
+		select {
+		case msg, opened = <-channel:
+		case <-l.batchTimerChan():
+			l.sync.procMtx.RLock()
+			l.flushBatches(false)
+			l.sync.procMtx.RUnlock()
+			continue
+		}
 		if !opened {
 			break
 		}
-		if err := l.proceedMsg(&msg); err != nil {
-			l.fbckWriteln("error proceeding message: " + err.Error())
+		l.signalRoom()
+		for _, rescued := range l.takeRescued() {
+			// queued before msg (see evictOldest)
+			l.proceedQueued(channel, &rescued)
 		}
+		l.proceedQueued(channel, &msg)
+	}
+	if l.abandon.Load() {
+		l.abandonBatches()
+		return
 	}
+	l.sync.procMtx.RLock()
+	l.flushBatches(true)
+	l.sync.procMtx.RUnlock()
+	l.reportDropped(channel, true)
+}
+
+// Proceeds a message received from the queue (or skips it after the shutdown
+// deadline) and writes the dropped messages notice if it is time to.
+func (l *Logger) proceedQueued(channel chan logMessage, msg *logMessage) {
+	if msg.protect {
+		l.overflow.protected.Add(-1)
+	}
+	if l.abandon.Load() {
+		// the shutdown deadline is exceeded
+		l.abandonMessage(msg)
+		return
+	}
+	if err := l.proceedMsg(msg); err != nil {
+		l.fbckWriteln("error proceeding message: " + err.Error())
+	}
+	l.reportDropped(channel, false)
 }
 
 // Dispatches a single message. Commands are executed (proceedCmd) and then converted
@@ -99,6 +157,11 @@ func (l *Logger) proceedMsg(msg *logMessage) (err error) {
 		msg.annex = basetype(LVL_TRACE)
 		fallthrough
 	case _MSG_LOG_TEXT:
+		if msg.args != nil {
+			// Logf_deferred: arguments of basic types only (no user methods called)
+			msg.msgdata = fmt.Appendf(nil, string(msg.msgdata), msg.args...)
+			msg.args = nil
+		}
 		l.logTextToOutputs(msg)
 	case _MSG_FORBIDDEN:
 		// For testing purposes only — panic to exercise panic handling
@@ -138,6 +201,12 @@ func (l *Logger) proceedCmd(msg *logMessage) (err error) {
 		case _CMD_PING_FALLBACK:
 			// ping fallback writes a fixed message to indicate the fallback is reachable
 			errstr = _COMMAND_PING_MESSAGE
+		case _CMD_OUTPUTS_REOPEN:
+			// reopen outputs supporting it (all errors are joined)
+			errstr = l.reopenOutputs()
+		case _CMD_OUTPUTS_FLUSH:
+			// barrier: the result is sent when all outputs pass it
+			l.flushOutputs(msg.done)
 		default:
 			errstr = "unknown command: " + msgDescStr(msg)
 		}
@@ -149,34 +218,104 @@ func (l *Logger) proceedCmd(msg *logMessage) (err error) {
 	return
 }
 
-// Writes the provided text message to each enabled output.
+// Writes the provided text message to each enabled output and records the message
+// processing latency.
 //
-// Write errors are passed to the fallback writer. The output is disabled on write panic
-// to avoid further repeated panics.
+// Disabled outputs with a due retry get the message as a probe (see SetOutputRetry).
+// Async outputs get the formatted message in their queues (see SetOutputAsync), so
+// the latency of them doesn't include the write time.
 func (l *Logger) logTextToOutputs(msg *logMessage) {
+	async := 0
 	for output, settings := range l.outputs {
-		if output != nil && settings != nil && settings.enabled {
-			panicked, err := l.logTextData(output, msg)
-			if panicked {
-				// got panic writing, disable output for further writes
-				l.outputs[output].enabled = false
-			}
-			if err != nil {
-				l.handleLogWriteError(err.Error())
+		if output == nil || settings == nil {
+			continue
+		}
+		write, probe, queue := l.outputDispatch(settings, LogLevel(msg.annex))
+		aw := l.asyncWriterFor(output, settings, queue)
+		if aw != nil {
+			async++
+		}
+		if write {
+			panicked, err := l.logTextData(output, msg, probe)
+			if aw == nil || err != nil {
+				// the result of async writes is handled by the output writer
+				l.outputWritten(output, settings, probe, panicked, err)
 			}
 		}
 	}
+	if len(l.asyncs) > async {
+		l.sweepAsync()
+	}
+	if !msg.pushed.IsZero() {
+		l.stats.latency.record(time.Since(msg.pushed))
+	}
+}
+
+// Returns whether the message has to be written to the output (probe is true for
+// a retry probe of a disabled output) and the async queue size of the output.
+func (l *Logger) outputDispatch(context *outContext, level LogLevel) (write, probe bool, queue int) {
+	l.sync.outsMtx.RLock()
+	enabled, due, queue := context.enabled, context.retry.due(), context.asyncsize
+	l.sync.outsMtx.RUnlock()
+	if enabled || !due || !l.outputAccepts(context, level) {
+		return enabled, false, queue
+	}
+	l.sync.outsMtx.Lock()
+	defer l.sync.outsMtx.Unlock()
+	if context.enabled || !context.retry.due() {
+		return context.enabled, false, queue
+	}
+	// no more probes until the result of this one
+	context.retry.next = time.Time{}
+	return true, true, queue
+}
+
+// Handles the result of writing a message to the output: write errors are passed
+// to the fallback writer, the output is disabled on write panic to avoid further
+// repeated panics (and on write timeout if set so), retry probes enable the output
+// or schedule the next probe. Errors and panics are counted per output.
+func (l *Logger) outputWritten(output OutType, context *outContext, probe, panicked bool, err error) {
+	if panicked {
+		context.stats.panics.Add(1)
+	}
+	switch {
+	case errors.Is(err, errWriteBlocked):
+		// reported once the abandoned write returns
+		l.countSkipped(context)
+	case err != nil:
+		context.stats.errors.Add(1)
+		l.handleLogWriteError(err.Error())
+	}
+	timedout := false
+	if errors.Is(err, ErrWriteTimeout) && !errors.Is(err, errWriteBlocked) {
+		context.stats.timeouts.Add(1)
+		l.sync.outsMtx.RLock()
+		timedout = context.timeout.disable
+		l.sync.outsMtx.RUnlock()
+	}
+	switch {
+	case panicked || timedout || (probe && err != nil):
+		// disable output for further writes (or wait for the next probe)
+		l.outputFailed(output, context, err)
+	case probe:
+		l.outputRecovered(output, context)
+	}
 }
 
-// Writes the text message for a specified output.
+// Returns whether a message of the level passes the output and logger min levels.
+func (l *Logger) outputAccepts(context *outContext, level LogLevel) bool {
+	return context == nil || (level >= context.minlevel && level >= l.level)
+}
+
+// Writes the text message for a specified output (or queues it for async outputs,
+// probe is passed to the output writer).
 //
 // Return values: panicked (true if a panic occurred while writing) and err for any
 // write-related error. The deferred recover converts the panic into an error.
-func (l *Logger) logTextData(output OutType, msg *logMessage) (panicked bool, err error) {
+func (l *Logger) logTextData(output OutType, msg *logMessage, probe bool) (panicked bool, err error) {
 	// only returns of named result values can be changed by defer:
 	// https://bytegoblin.io/blog/golang-magic-modify-return-value-using-deferred-function
 	panicked = false
-	proceed := true
 	defer func() {
 		if r := recover(); r != nil {
 			panicked = true
@@ -185,32 +324,76 @@ func (l *Logger) logTextData(output OutType, msg *logMessage) (panicked bool, er
 	}()
 	level := LogLevel(msg.annex)
 	context := l.outputs[output]
-	if context != nil {
-		proceed = level >= context.minlevel && level >= l.level
-	}
-	if proceed {
-		buildTextMessage(l.msgbuf, msg, context)
-		n, e := l.msgbuf.WriteTo(output)
+	if l.outputAccepts(context, level) {
+		buildMessage(l.msgbuf, msg, context)
+		if context != nil {
+			if batchSplits(output, context, msg) {
+				err = l.writeBatch(output, context, false)
+			}
+			if batched, flush := l.batchMessage(output, context, msg, probe); batched {
+				if flush {
+					if e := l.writeBatch(output, context, probe); e != nil {
+						err = e
+					}
+				}
+				return
+			}
+		}
+		if aw := l.asyncs[output]; aw != nil {
+			l.pushAsyncMessage(aw, msg, probe)
+			return
+		}
+		n, e := l.writeOutput(output, context, l.msgbuf, msg.pushed)
 		if e != nil {
-			err = errors.New("error writing log to output (" + strconv.FormatInt(n, 10) + " bytes written): " + e.Error())
+			err = newWriteError(n, e)
+		} else {
+			l.countWritten(context, msg, n)
 		}
+	} else {
+		context.stats.filtered[normLevel(level)].Add(1)
 	}
 	return
 }
 
+// causedError is an error with its own text keeping the original error as cause.
+type causedError struct {
+	text string
+	err  error
+}
+
+func (e *causedError) Error() string { return e.text }
+func (e *causedError) Unwrap() error { return e.err }
+
+// Returns the error of an output write with the number of bytes written.
+func newWriteError(n int64, err error) error {
+	return &causedError{"error writing log to output (" + strconv.FormatInt(n, 10) + " bytes written): " + err.Error(), err}
+}
+
+// Writes the buffer content to the output in a single write call. Outputs implementing
+// TimedWriter get the message queue time along with the data.
+func writeBuffer(output OutType, buf *bytes.Buffer, pushed time.Time) (int64, error) {
+	if tw, ok := output.(TimedWriter); ok {
+		n, err := tw.WriteTimed(buf.Bytes(), pushed)
+		buf.Reset()
+		return int64(n), err
+	}
+	return buf.WriteTo(output)
+}
+
 // Writes a specified string to the logger fallback.
 //
-// A read lock is used to prevent fallbcsk changes on write.
+// An exclusive lock is used to prevent fallback changes on write and concurrent
+// writes from async output writers.
 func (l *Logger) handleLogWriteError(errormsg string) {
-	l.sync.fbckMtx.RLock()
-	defer l.sync.fbckMtx.RUnlock()
+	l.sync.fbckMtx.Lock()
+	defer l.sync.fbckMtx.Unlock()
 	if l.fallbck != nil {
 		l.fbckWriteln(errormsg)
 	}
 }
 
 // Constructs and buffers the textual representation for a message using the provided
-// output context.
+// output context (default [FMT_TEXT] format).
 func buildTextMessage(outBuffer *bytes.Buffer, msg *logMessage, context *outContext) *bytes.Buffer {
 	outBuffer.Reset()
 	if msg != nil {
@@ -220,6 +403,7 @@ func buildTextMessage(outBuffer *bytes.Buffer, msg *logMessage, context *outCont
 			// optional time prefix
 			if len(context.timefmt) > 0 {
 				outBuffer.Write([]byte(msg.pushed.Format(context.timefmt)))
+				outBuffer.Write(context.timedlm)
 			}
 			// optional numeric level id (compact path for small max)
 			if context.showlvlid {
@@ -250,6 +434,14 @@ func buildTextMessage(outBuffer *bytes.Buffer, msg *logMessage, context *outCont
 		}
 		// the actual log text
 		outBuffer.Write(msg.msgdata)
+		// structured fields (separators are taken from context or defaults)
+		if len(msg.fields) > 0 {
+			fieldsep, fieldasg := []byte(DEFAULT_FIELD_SEP), []byte(DEFAULT_FIELD_ASSIGN)
+			if context != nil {
+				fieldsep, fieldasg = context.fieldsep, context.fieldasg
+			}
+			buildTextFields(outBuffer, msg.fields, fieldsep, fieldasg)
+		}
 		if withColor {
 			// append reset sequence if color was used
 			outBuffer.Write([]byte(ANSI_COL_RESET))
@@ -259,3 +451,13 @@ func buildTextMessage(outBuffer *bytes.Buffer, msg *logMessage, context *outCont
 	}
 	return outBuffer
 }
+
+// Appends structured fields as `<separator>key<assign>value` sequences.
+func buildTextFields(outBuffer *bytes.Buffer, fields []Field, separator, assign []byte) {
+	for i := range fields {
+		outBuffer.Write(separator)
+		outBuffer.WriteString(fields[i].key)
+		outBuffer.Write(assign)
+		outBuffer.Write(appendFieldValue(outBuffer.AvailableBuffer(), &fields[i]))
+	}
+}
@@ -131,7 +131,7 @@ func Test_Logger_logData(t *testing.T) {
 			foutput.Clear()
 			l := Init()
 			l.msgbuf = bytes.NewBuffer(make([]byte, DEFAULT_OUT_BUFF))
-			gotPnc, gotErr := l.logTextData(tt.output, &logMessage{msgtype: 99, msgdata: tt.data})
+			gotPnc, gotErr := l.logTextData(tt.output, &logMessage{msgtype: 99, msgdata: tt.data}, false)
 			assert.True(t, !tt.wantPnc || gotPnc, "did not panic when expected")
 			assert.True(t, !tt.wantErr || gotErr != nil, "no error on expected failure")
 			assert.False(t, !tt.wantPnc && gotPnc, "unexpected panic")
@@ -442,6 +442,7 @@ func Test_Logger_proceedCmd(t *testing.T) {
 	}{
 		{"ping", _CMD_PING_FALLBACK, nil, []byte{}, "<ping>"},
 		{"dummy", _CMD_DUMMY, nil, []byte{}, ""},
+		{"reopen", _CMD_OUTPUTS_REOPEN, nil, []byte{}, ""},
 		{"unknown", _CMD_MAX_for_checks_only + 10, nil, []byte{}, "unknown command"},
 		{"min_level", _CMD_CLIENT_SET_LEVEL, lc1, []byte{byte(LVL_FATAL)}, ""},
 		{"min_level_no_data", _CMD_CLIENT_SET_LEVEL, lc1, []byte{}, "no data"},
@@ -0,0 +1,198 @@
+package lgr
+
+/*
+Reopenable file output for external log rotation (logrotate etc).
+
+External tools rename (or remove) the log file and signal the program to close
+and reopen the path, so new messages go to a new file. ReopenFile is a plain
+appending file writer implementing Reopener. Reopening is executed as a queued
+command (Logger.ReopenOutputs): all messages queued before the request are
+written to the old file, all messages queued after it go to the new one.
+
+Logger.ReopenOutputsOnSignal subscribes to OS signals (SIGHUP by default) and
+queues the reopen command on each of them.
+*/
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ReopenFile is an appending file output that can be reopened by path. It is
+// safe for concurrent use, but it is intended to be written by the logger
+// processing goroutine only.
+type ReopenFile struct {
+	mtx    sync.Mutex
+	path   string   // file path
+	file   *os.File // nil if closed or failed to reopen
+	closed bool
+}
+
+// Opens (or creates) the file at path for appending and returns a writer that
+// can reopen it (see Reopen).
+func NewReopenFile(path string) (*ReopenFile, error) {
+	rf := &ReopenFile{path: path}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+// Write implements io.Writer. If the previous reopen failed, the file is opened
+// again before writing.
+func (rf *ReopenFile) Write(p []byte) (n int, err error) {
+	rf.mtx.Lock()
+	defer rf.mtx.Unlock()
+	if rf.closed {
+		return 0, errors.New(_ERROR_MESSAGE_FILE_CLOSED)
+	}
+	if rf.file == nil {
+		if err = rf.open(); err != nil {
+			return 0, err
+		}
+	}
+	return rf.file.Write(p)
+}
+
+// Reopen implements Reopener: closes the current file and opens (or creates) the
+// file at the same path. Called directly it takes effect immediately, use
+// Logger.ReopenOutputs to reopen in order with queued messages.
+//
+// On error the writer is left without file and the next Write tries to open it.
+func (rf *ReopenFile) Reopen() error {
+	rf.mtx.Lock()
+	defer rf.mtx.Unlock()
+	if rf.closed {
+		return errors.New(_ERROR_MESSAGE_FILE_CLOSED)
+	}
+	if rf.file != nil {
+		err := rf.file.Close()
+		rf.file = nil
+		if err != nil {
+			return err
+		}
+	}
+	return rf.open()
+}
+
+// Close closes the current file. Any further writes return an error.
+func (rf *ReopenFile) Close() (err error) {
+	rf.mtx.Lock()
+	defer rf.mtx.Unlock()
+	if rf.file != nil {
+		err = rf.file.Close()
+		rf.file = nil
+	}
+	rf.closed = true
+	return err
+}
+
+// Commits the current file to the storage (see Logger.Flush).
+func (rf *ReopenFile) Sync() error {
+	rf.mtx.Lock()
+	defer rf.mtx.Unlock()
+	if rf.file == nil {
+		return nil
+	}
+	return rf.file.Sync()
+}
+
+// Returns the file path.
+func (rf *ReopenFile) Name() string {
+	return rf.path
+}
+
+// Opens the file for appending. Must be called with the mutex held.
+func (rf *ReopenFile) open() error {
+	f, err := os.OpenFile(rf.path, _FILE_OPEN_FLAGS, DEFAULT_FILE_MODE)
+	if err != nil {
+		return err
+	}
+	rf.file = f
+	return nil
+}
+
+/////////////////////////////////////////////////////////////////////////////////////////
+
+// Enqueues a command to reopen all outputs implementing Reopener. The outputs are
+// reopened only after previously queued messages are processed. Reopen errors are
+// written to the fallback writer.
+func (l *Logger) ReopenOutputs() (time.Time, error) {
+	return l.pushMessage(makeCmdMessage(nil, _CMD_OUTPUTS_REOPEN, nil))
+}
+
+// Calls ReopenOutputs every time one of the signals (syscall.SIGHUP if none) is
+// received until the returned stop function is called. Queue errors (e.g. the
+// logger is stopped) are written to the fallback writer.
+func (l *Logger) ReopenOutputsOnSignal(sigs ...os.Signal) (stop func()) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{syscall.SIGHUP}
+	}
+	sigchan := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(sigchan, sigs...)
+	go func() {
+		for {
+			select {
+			case <-sigchan:
+				if _, err := l.ReopenOutputs(); err != nil {
+					l.handleLogWriteError("reopen outputs: " + err.Error())
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(sigchan)
+			close(done)
+		})
+	}
+}
+
+// Writes pending batches and reopens all outputs implementing Reopener (called by
+// the processing goroutine only), so batched messages queued before the command
+// go to the old files. Returns the joined text of errors and panics (empty if
+// none). Async outputs are reopened by their writers after writing the queued
+// messages without waiting, their errors are written to the fallback by the writers.
+func (l *Logger) reopenOutputs() (errstr string) {
+	l.flushBatches(true)
+	for output := range l.outputs {
+		if r, ok := output.(Reopener); ok {
+			if aw := l.asyncs[output]; aw != nil {
+				aw.after(func() {
+					if err := reopenOutput(r); err != nil {
+						l.handleLogWriteError(err.Error())
+					}
+				})
+				continue
+			}
+			if err := reopenOutput(r); err != nil {
+				if len(errstr) > 0 {
+					errstr += "; "
+				}
+				errstr += err.Error()
+			}
+		}
+	}
+	return errstr
+}
+
+// Calls Reopen converting a panic into an error.
+func reopenOutput(r Reopener) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = errors.New("panic reopening output" + panicDesc(p))
+		}
+	}()
+	if err = r.Reopen(); err != nil {
+		err = errors.New("error reopening output: " + err.Error())
+	}
+	return err
+}
@@ -0,0 +1,158 @@
+package lgr
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type panicReopener struct{ FakeWriter }
+
+func (*panicReopener) Reopen() error { panic("test reopen panic") }
+
+func Test_ReopenFile(t *testing.T) {
+	t.Run("wrong_path", func(t *testing.T) {
+		rf, err := NewReopenFile(filepath.Join(t.TempDir(), "no", "app.log"))
+		assert.Nil(t, rf)
+		assert.Error(t, err)
+	})
+	t.Run("reopen", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "app.log")
+		rf, err := NewReopenFile(path)
+		assert.NoError(t, err)
+		assert.Equal(t, path, rf.Name())
+		rf.Write([]byte("a\n"))
+		assert.NoError(t, os.Rename(path, path+".1"))
+		rf.Write([]byte("b\n")) // still to the moved file
+		assert.NoError(t, rf.Reopen())
+		n, err := rf.Write([]byte("c\n"))
+		assert.NoError(t, err)
+		assert.Equal(t, 2, n)
+		assert.NoError(t, rf.Close())
+		assert.Equal(t, "a\nb\n", readFileStr(t, path+".1"))
+		assert.Equal(t, "c\n", readFileStr(t, path))
+	})
+	t.Run("reopen_failed", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "app.log")
+		rf, _ := NewReopenFile(path)
+		assert.NoError(t, os.Rename(path, path+".1"))
+		assert.NoError(t, os.Mkdir(path, 0755))
+		assert.Error(t, rf.Reopen())
+		assert.Nil(t, rf.file)
+		_, err := rf.Write([]byte("x\n"))
+		assert.Error(t, err)
+		assert.NoError(t, os.Remove(path))
+		_, err = rf.Write([]byte("y\n")) // opened again
+		assert.NoError(t, err)
+		rf.Close()
+		assert.Equal(t, "y\n", readFileStr(t, path))
+	})
+	t.Run("closed", func(t *testing.T) {
+		rf, _ := NewReopenFile(filepath.Join(t.TempDir(), "app.log"))
+		assert.NoError(t, rf.Close())
+		assert.NoError(t, rf.Close(), "error on double close")
+		n, err := rf.Write([]byte("x"))
+		assert.Zero(t, n)
+		assert.EqualError(t, err, _ERROR_MESSAGE_FILE_CLOSED)
+		assert.EqualError(t, rf.Reopen(), _ERROR_MESSAGE_FILE_CLOSED)
+	})
+}
+
+func Test_Logger_ReopenOutputs(t *testing.T) {
+	t.Run("queued", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "app.log")
+		rf, _ := NewReopenFile(path)
+		ferr := &FakeWriter{}
+		l := InitWithParams(LVL_INFO, ferr, rf)
+		lc := l.NewClient("c")
+		_, err := l.ReopenOutputs()
+		assert.Error(t, err, "no error for inactive logger")
+		l.Start(10)
+		l.sync.procMtx.Lock() // hold processing until everything is queued
+		lc.LogInfo("before")
+		_, err = l.ReopenOutputs()
+		assert.NoError(t, err)
+		lc.LogInfo("after")
+		assert.NoError(t, os.Rename(path, path+".1"))
+		l.sync.procMtx.Unlock()
+		l.StopAndWait()
+		rf.Close()
+		assert.Empty(t, ferr.buffer)
+		assert.Equal(t, "c:before\n", readFileStr(t, path+".1"))
+		assert.Equal(t, "c:after\n", readFileStr(t, path))
+	})
+	t.Run("batched", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "app.log")
+		rf, _ := NewReopenFile(path)
+		ferr := &FakeWriter{}
+		l := InitWithParams(LVL_INFO, ferr, rf)
+		l.SetOutputBatching(rf, 1<<20, time.Hour)
+		lc := l.NewClient("c")
+		l.Start(10)
+		lc.LogInfo("before1")
+		lc.LogInfo("before2")
+		assert.NoError(t, l.Flush(context.Background()))
+		assert.Equal(t, "c:before1\nc:before2\n", readFileStr(t, path))
+		lc.LogInfo("before3")
+		assert.NoError(t, os.Rename(path, path+".1"))
+		l.ReopenOutputs()
+		lc.LogInfo("after")
+		l.StopAndWait()
+		rf.Close()
+		assert.Empty(t, ferr.buffer)
+		assert.Equal(t, "c:before1\nc:before2\nc:before3\n", readFileStr(t, path+".1"))
+		assert.Equal(t, "c:after\n", readFileStr(t, path))
+	})
+	t.Run("errors", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "app.log")
+		rf, _ := NewReopenFile(path)
+		rf.Close()
+		ferr := &FakeWriter{}
+		l := InitWithParams(LVL_INFO, ferr, rf, &panicReopener{}, &FakeWriter{})
+		assert.Error(t, l.proceedCmd(makeCmdMessage(nil, _CMD_OUTPUTS_REOPEN, nil)))
+		assert.Contains(t, ferr.String(), "error reopening output: "+_ERROR_MESSAGE_FILE_CLOSED)
+		assert.Contains(t, ferr.String(), "panic reopening output: `test reopen panic`")
+	})
+}
+
+func Test_Logger_ReopenOutputsOnSignal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("SIGHUP can't be sent on windows")
+	}
+	path := filepath.Join(t.TempDir(), "app.log")
+	rf, _ := NewReopenFile(path)
+	l := InitWithParams(LVL_INFO, &FakeWriter{}, rf)
+	lc := l.NewClient("c")
+	l.Start(10)
+	stop := l.ReopenOutputsOnSignal()
+	defer stop()
+	lc.LogInfo("before")
+	for range 100 { // wait for the message to be written
+		if s, _ := os.ReadFile(path); len(s) > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	assert.NoError(t, os.Rename(path, path+".1"))
+	p, _ := os.FindProcess(os.Getpid())
+	assert.NoError(t, p.Signal(syscall.SIGHUP))
+	for range 100 { // wait for the file to be reopened
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	lc.LogInfo("after")
+	l.StopAndWait()
+	stop()
+	stop() // no panic on repeated stop
+	rf.Close()
+	assert.Equal(t, "c:before\n", readFileStr(t, path+".1"))
+	assert.Equal(t, "c:after\n", readFileStr(t, path))
+}
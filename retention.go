@@ -0,0 +1,245 @@
+package lgr
+
+/*
+Compression and retention of rotated log files.
+
+Rotating file outputs (RotatingFile, TimeRotatingFile) embed fileRetention that
+post-processes rotated segments in a background goroutine, so the logger
+processing goroutine only pays for a single rename on rotation:
+  - optional gzip compression of rotated segments (file -> file.gz)
+  - pruning of rotated segments by max age, max count and max total size
+
+Background jobs are executed one by one in the order of rotations. Errors are
+reported through the fallback of the logger the output is attached to (see
+errorReporter and Logger.AddOutputs).
+*/
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	_GZIP_EXT           = ".gz"
+	_PENDING_EXT        = ".rotating-" // suffix of renamed segments waiting for compression
+	_ROTATION_ERROR_PFX = "log rotation: "
+)
+
+// errorReporter is implemented by outputs that report errors occurred outside of
+// Write calls (e.g. in background goroutines). The logger sets its fallback writer
+// handler when such an output is added.
+type errorReporter interface {
+	setErrorHandler(func(string))
+}
+
+// Unique suffix counter for pending segments.
+var pendingCounter atomic.Uint64
+
+// bgQueue runs jobs in a single background goroutine in the order of pushing.
+// The goroutine is started on demand and exits when there are no jobs left.
+type bgQueue struct {
+	mtx     sync.Mutex
+	jobs    []func()
+	running bool
+	wait    sync.WaitGroup
+}
+
+// Adds a job to the queue (never blocks on job execution).
+func (q *bgQueue) push(job func()) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	q.jobs = append(q.jobs, job)
+	if !q.running {
+		q.running = true
+		q.wait.Go(q.run)
+	}
+}
+
+// Executes queued jobs until the queue is empty.
+func (q *bgQueue) run() {
+	for {
+		q.mtx.Lock()
+		if len(q.jobs) == 0 {
+			q.running = false
+			q.mtx.Unlock()
+			return
+		}
+		job := q.jobs[0]
+		q.jobs = q.jobs[1:]
+		q.mtx.Unlock()
+		job()
+	}
+}
+
+// Blocks until all queued jobs are done.
+func (q *bgQueue) flush() {
+	q.wait.Wait()
+}
+
+// fileRetention holds compression and retention settings of rotated segments and
+// the queue of background jobs processing them.
+type fileRetention struct {
+	mtx      sync.Mutex    // guards settings and error handler
+	compress bool          // gzip rotated segments
+	maxAge   time.Duration // remove segments older than (0 - no limit)
+	maxCount int           // keep no more segments than (0 - no limit)
+	maxTotal int64         // keep no more bytes in segments than (0 - no limit)
+	onError  func(string)  // background errors handler
+	queue    bgQueue
+}
+
+// segment is a rotated file found by retention pruning.
+type segment struct {
+	path    string
+	size    int64
+	modtime time.Time
+}
+
+// Enables or disables gzip compression of rotated segments (in a background
+// goroutine). Compressed segments get ".gz" extension.
+func (fr *fileRetention) SetCompression(enabled bool) {
+	fr.mtx.Lock()
+	defer fr.mtx.Unlock()
+	fr.compress = enabled
+}
+
+// Sets the max age of rotated segments (by modification time), older ones are
+// removed after the next rotation. Zero or negative age disables the limit.
+func (fr *fileRetention) SetMaxAge(age time.Duration) {
+	fr.mtx.Lock()
+	defer fr.mtx.Unlock()
+	fr.maxAge = max(age, 0)
+}
+
+// Sets the max number of rotated segments to keep, the oldest ones are removed
+// after the next rotation. Zero or negative count disables the limit.
+func (fr *fileRetention) SetMaxCount(count int) {
+	fr.mtx.Lock()
+	defer fr.mtx.Unlock()
+	fr.maxCount = max(count, 0)
+}
+
+// Sets the max total size of rotated segments to keep, the oldest ones are removed
+// after the next rotation. Zero or negative size disables the limit.
+func (fr *fileRetention) SetMaxTotalSize(size int64) {
+	fr.mtx.Lock()
+	defer fr.mtx.Unlock()
+	fr.maxTotal = max(size, 0)
+}
+
+// Implements errorReporter.
+func (fr *fileRetention) setErrorHandler(handler func(string)) {
+	fr.mtx.Lock()
+	defer fr.mtx.Unlock()
+	fr.onError = handler
+}
+
+// Returns whether compression is enabled.
+func (fr *fileRetention) compressed() bool {
+	fr.mtx.Lock()
+	defer fr.mtx.Unlock()
+	return fr.compress
+}
+
+// Passes a background error to the handler (if any). Panics of the handler are
+// suppressed, as there is nowhere to report them from the background goroutine.
+func (fr *fileRetention) report(err error) {
+	fr.mtx.Lock()
+	handler := fr.onError
+	fr.mtx.Unlock()
+	if err != nil && handler != nil {
+		defer func() { recover() }()
+		handler(_ROTATION_ERROR_PFX + err.Error())
+	}
+}
+
+// Returns a unique name to rename a rotated file before compression.
+func pendingName(path string) string {
+	return path + _PENDING_EXT + strconv.FormatUint(pendingCounter.Add(1), 10)
+}
+
+// Removes segments exceeding the limits. Segments must be sorted from the newest
+// to the oldest: once a segment is over any limit it is removed with all older ones.
+func (fr *fileRetention) prune(segments []segment) {
+	fr.mtx.Lock()
+	maxAge, maxCount, maxTotal := fr.maxAge, fr.maxCount, fr.maxTotal
+	fr.mtx.Unlock()
+	var cutoff time.Time
+	if maxAge > 0 {
+		cutoff = time.Now().Add(-maxAge)
+	}
+	total := int64(0)
+	expired := false
+	for i, s := range segments {
+		total += s.size
+		expired = expired ||
+			(maxCount > 0 && i >= maxCount) ||
+			(maxTotal > 0 && total > maxTotal) ||
+			(maxAge > 0 && s.modtime.Before(cutoff))
+		if expired {
+			if err := os.Remove(s.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				fr.report(err)
+			}
+		}
+	}
+}
+
+// Appends a segment for path if the file exists.
+func appendSegment(segments []segment, path string) []segment {
+	if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+		segments = append(segments, segment{path, info.Size(), info.ModTime()})
+	}
+	return segments
+}
+
+// Sorts segments from the newest to the oldest by modification time (stable, so
+// the initial order is kept for equal times).
+func sortSegments(segments []segment) {
+	slices.SortStableFunc(segments, func(a, b segment) int {
+		return b.modtime.Compare(a.modtime)
+	})
+}
+
+// Compresses src into dst (appended as a new gzip member if dst exists, which is
+// valid for gzip readers) and removes src. On error dst is restored to its
+// initial size and src is kept.
+func gzipFile(src, dst string) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, _FILE_OPEN_FLAGS, DEFAULT_FILE_MODE)
+	if err != nil {
+		return err
+	}
+	info, err := out.Stat()
+	if err != nil {
+		out.Close()
+		return err
+	}
+	defer func() {
+		if err != nil {
+			out.Truncate(info.Size())
+		}
+		if e := out.Close(); err == nil {
+			err = e
+		}
+		if err == nil {
+			in.Close()
+			err = os.Remove(src)
+		}
+	}()
+	gz := gzip.NewWriter(out)
+	if _, err = io.Copy(gz, in); err != nil {
+		return err
+	}
+	return gz.Close()
+}
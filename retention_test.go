@@ -0,0 +1,247 @@
+package lgr
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readGzipStr(t *testing.T, path string) string {
+	f, err := os.Open(path)
+	if !assert.NoError(t, err, "error opening "+path) {
+		return ""
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if !assert.NoError(t, err, "error reading gzip "+path) {
+		return ""
+	}
+	data, err := io.ReadAll(gz)
+	assert.NoError(t, err, "error reading gzip "+path)
+	return string(data)
+}
+
+func Test_bgQueue(t *testing.T) {
+	q := bgQueue{}
+	q.flush() // no jobs, no wait
+	done := []int{}
+	for i := range 100 {
+		q.push(func() { done = append(done, i) })
+	}
+	q.flush()
+	assert.Len(t, done, 100)
+	for i, v := range done {
+		assert.Equal(t, i, v, "wrong order of jobs")
+	}
+	assert.False(t, q.running)
+	q.push(func() { done = nil }) // restarted
+	q.flush()
+	assert.Nil(t, done)
+}
+
+func Test_gzipFile(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst.gz")
+	t.Run("new", func(t *testing.T) {
+		assert.NoError(t, os.WriteFile(src, []byte("first\n"), DEFAULT_FILE_MODE))
+		assert.NoError(t, gzipFile(src, dst))
+		assert.NoFileExists(t, src)
+		assert.Equal(t, "first\n", readGzipStr(t, dst))
+	})
+	t.Run("append", func(t *testing.T) {
+		assert.NoError(t, os.WriteFile(src, []byte("second\n"), DEFAULT_FILE_MODE))
+		assert.NoError(t, gzipFile(src, dst))
+		assert.Equal(t, "first\nsecond\n", readGzipStr(t, dst))
+	})
+	t.Run("no_src", func(t *testing.T) {
+		assert.Error(t, gzipFile(src, dst))
+		assert.Equal(t, "first\nsecond\n", readGzipStr(t, dst))
+	})
+	t.Run("src_is_dir", func(t *testing.T) {
+		assert.NoError(t, os.Mkdir(src, 0755))
+		defer os.Remove(src)
+		assert.Error(t, gzipFile(src, dst))
+		assert.DirExists(t, src)
+		assert.Equal(t, "first\nsecond\n", readGzipStr(t, dst), "destination is not restored")
+	})
+}
+
+func Test_fileRetention_prune(t *testing.T) {
+	now := time.Now()
+	makeSegments := func(t *testing.T) []segment {
+		dir := t.TempDir()
+		segments := []segment{}
+		for i := range 5 {
+			path := filepath.Join(dir, strconv.Itoa(i))
+			assert.NoError(t, os.WriteFile(path, []byte("1234567890"), DEFAULT_FILE_MODE))
+			mtime := now.Add(-time.Duration(i) * time.Hour)
+			assert.NoError(t, os.Chtimes(path, mtime, mtime))
+			segments = appendSegment(segments, path)
+		}
+		return segments
+	}
+	kept := func(segments []segment) (n int) {
+		for _, s := range segments {
+			if _, err := os.Stat(s.path); err == nil {
+				n++
+			}
+		}
+		return n
+	}
+	tests := []struct {
+		name  string
+		setup func(fr *fileRetention)
+		want  int
+	}{
+		{"no_limits", func(fr *fileRetention) {}, 5},
+		{"count", func(fr *fileRetention) { fr.SetMaxCount(3) }, 3},
+		{"negative_count", func(fr *fileRetention) { fr.SetMaxCount(-3) }, 5},
+		{"size", func(fr *fileRetention) { fr.SetMaxTotalSize(25) }, 2},
+		{"age", func(fr *fileRetention) { fr.SetMaxAge(150 * time.Minute) }, 3},
+		{"all", func(fr *fileRetention) {
+			fr.SetMaxCount(4)
+			fr.SetMaxTotalSize(100)
+			fr.SetMaxAge(90 * time.Minute)
+		}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			segments := makeSegments(t)
+			assert.Len(t, segments, 5)
+			fr := &fileRetention{}
+			tt.setup(fr)
+			fr.prune(segments)
+			assert.Equal(t, tt.want, kept(segments))
+			for i := range tt.want {
+				assert.FileExists(t, segments[i].path, "not the oldest is removed")
+			}
+		})
+	}
+	t.Run("sort", func(t *testing.T) {
+		segments := makeSegments(t)
+		segments[0], segments[4] = segments[4], segments[0]
+		sortSegments(segments)
+		for i := 1; i < len(segments); i++ {
+			assert.True(t, segments[i-1].modtime.After(segments[i].modtime))
+		}
+	})
+}
+
+func Test_fileRetention_report(t *testing.T) {
+	fr := &fileRetention{}
+	assert.NotPanics(t, func() { fr.report(os.ErrClosed) }, "no handler")
+	got := ""
+	fr.setErrorHandler(func(s string) { got = s })
+	fr.report(nil)
+	assert.Empty(t, got)
+	fr.report(os.ErrClosed)
+	assert.Equal(t, _ROTATION_ERROR_PFX+os.ErrClosed.Error(), got)
+	fr.setErrorHandler(func(s string) { panic(s) })
+	assert.NotPanics(t, func() { fr.report(os.ErrClosed) }, "handler panic")
+}
+
+func Test_RotatingFile_Retention(t *testing.T) {
+	t.Run("compression", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "app.log")
+		rf, _ := NewRotatingFile(path, 20, 2)
+		rf.SetCompression(true)
+		for i := range 8 {
+			rf.Write([]byte("line #" + strconv.Itoa(i) + "\n"))
+		}
+		assert.NoError(t, rf.Close())
+		assert.Equal(t, "line #6\nline #7\n", readFileStr(t, path))
+		assert.Equal(t, "line #4\nline #5\n", readGzipStr(t, path+".1.gz"))
+		assert.Equal(t, "line #2\nline #3\n", readGzipStr(t, path+".2.gz"))
+		assert.NoFileExists(t, path+".1")
+		assert.NoFileExists(t, path+".3.gz", "extra backup is kept")
+		pending, _ := filepath.Glob(path + _PENDING_EXT + "*")
+		assert.Empty(t, pending)
+	})
+	t.Run("switch_compression", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "app.log")
+		rf, _ := NewRotatingFile(path, 20, 3)
+		rf.Write([]byte("a\n"))
+		rf.Rotate()
+		rf.SetCompression(true)
+		rf.Write([]byte("b\n"))
+		rf.Rotate()
+		rf.Write([]byte("c\n"))
+		assert.NoError(t, rf.Close())
+		assert.Equal(t, "c\n", readFileStr(t, path))
+		assert.Equal(t, "b\n", readGzipStr(t, path+".1.gz"))
+		assert.Equal(t, "a\n", readFileStr(t, path+".2"))
+	})
+	t.Run("max_count", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "app.log")
+		rf, _ := NewRotatingFile(path, 20, 5)
+		rf.SetMaxCount(2)
+		for i := range 5 {
+			rf.Write([]byte(strconv.Itoa(i) + "\n"))
+			rf.Rotate()
+		}
+		assert.NoError(t, rf.Close())
+		assert.Equal(t, "4\n", readFileStr(t, path+".1"))
+		assert.Equal(t, "3\n", readFileStr(t, path+".2"))
+		assert.NoFileExists(t, path+".3")
+	})
+}
+
+func Test_TimeRotatingFile_Retention(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2030, 1, d, 12, 0, 0, 0, time.Local) }
+	t.Run("compression", func(t *testing.T) {
+		dir := t.TempDir()
+		rf, _ := NewTimeRotatingFile(filepath.Join(dir, "app-2006-01-02.log"), ROTATE_DAILY)
+		rf.SetCompression(true)
+		rf.WriteTimed([]byte("a\n"), day(1))
+		rf.WriteTimed([]byte("b\n"), day(2))
+		rf.WriteTimed([]byte("c\n"), day(1)) // late message
+		rf.WriteTimed([]byte("d\n"), day(3))
+		assert.NoError(t, rf.Close())
+		assert.Equal(t, "a\nc\n", readGzipStr(t, filepath.Join(dir, "app-2030-01-01.log.gz")))
+		assert.Equal(t, "b\n", readGzipStr(t, filepath.Join(dir, "app-2030-01-02.log.gz")))
+		assert.Equal(t, "d\n", readFileStr(t, filepath.Join(dir, "app-2030-01-03.log")), "current file is compressed")
+		assert.NoFileExists(t, filepath.Join(dir, "app-2030-01-01.log"))
+	})
+	t.Run("max_count", func(t *testing.T) {
+		dir := t.TempDir()
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "other.log"), nil, DEFAULT_FILE_MODE))
+		rf, _ := NewTimeRotatingFile(filepath.Join(dir, "app-2006-01-02.log"), ROTATE_DAILY)
+		rf.SetMaxCount(1)
+		for d := 1; d <= 4; d++ {
+			rf.WriteTimed([]byte(strconv.Itoa(d)+"\n"), day(d))
+			time.Sleep(10 * time.Millisecond) // distinct modification times
+		}
+		assert.NoError(t, rf.Close())
+		entries, _ := os.ReadDir(dir)
+		names := []string{}
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		assert.ElementsMatch(t, []string{"other.log", "app-2030-01-03.log", "app-2030-01-04.log"}, names)
+	})
+}
+
+func Test_Retention_Logger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	rf, _ := NewRotatingFile(path, 10, 1)
+	rf.SetCompression(true)
+	ferr := &FakeWriter{}
+	l := InitWithParams(LVL_UNKNOWN, ferr, rf)
+	assert.NoError(t, os.Mkdir(path+".1.gz", 0755))            // compression fails
+	assert.NoError(t, os.WriteFile(path+".1.gz/x", nil, 0644)) // (non-empty directory)
+	lc := l.NewClient("c")
+	l.Start(0)
+	lc.LogInfo("first message")
+	lc.LogInfo("second message")
+	l.StopAndWait()
+	assert.NoError(t, rf.Close())
+	assert.Equal(t, "c:second message\n", readFileStr(t, path))
+	assert.Contains(t, ferr.String(), _ROTATION_ERROR_PFX)
+	assert.Equal(t, "c:first message\n", readFileStr(t, path+".1"), "not compressed backup is kept")
+}
@@ -0,0 +1,472 @@
+package lgr
+
+/*
+Rotating file outputs.
+
+RotatingFile is a file writer usable as logger output (OutType) that rotates
+the file when its size exceeds a configured limit and keeps a number of
+backups with numbered suffixes:
+
+	app.log      <- current file
+	app.log.1    <- the most recent backup
+	app.log.2
+	...
+
+Rotation happens inside Write (i.e. in the logger processing goroutine) before
+the write that would exceed the limit, so a formatted log line is never split
+between files.
+
+TimeRotatingFile switches files on wall-clock boundaries (hourly, daily or any
+custom interval). The file name is built from a time layout pattern like
+"app-2006-01-02.log". The file is chosen by the time the message was queued
+(see TimedWriter), not by the write time, so messages queued before midnight
+land in the right day's file even if the queue is backed up. Only moving forward
+in time switches the current file: late messages are appended to their previous
+file which is retired again once late messages stop. TimeRotatingFile implements
+TimedSplitter, so batches (see Logger.SetOutputBatching) never span files.
+
+Both outputs can compress and prune rotated files in the background (see
+fileRetention): on rotation the file is only renamed, the rest is done outside
+of the logger processing goroutine.
+*/
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_FILE_MODE os.FileMode = 0644 // permissions of created log files
+	_FILE_OPEN_FLAGS              = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+
+	// Predefined intervals of time-based rotation
+	ROTATE_HOURLY = time.Hour
+	ROTATE_DAILY  = 24 * time.Hour
+
+	_ERROR_MESSAGE_FILE_CLOSED   = "log file is closed"
+	_ERROR_MESSAGE_FILE_MAX_SIZE = "max file size must be positive"
+)
+
+// RotatingFile is a size-based rotating file output. It is safe for concurrent
+// use, but it is intended to be written by the logger processing goroutine only.
+type RotatingFile struct {
+	fileRetention // compression and retention of backups
+	mtx           sync.Mutex
+	path          string   // current file path
+	maxsize       int64    // size limit that triggers rotation
+	backups       int      // number of numbered backups to keep
+	file          *os.File // nil if closed or failed to reopen
+	size          int64    // current file size
+	closed        bool
+}
+
+// Opens (or creates) the file at path for appending and returns a writer that
+// rotates it when the size would exceed maxsize bytes. Up to backups previous
+// files are kept as path.1 ... path.N (the oldest is removed), with zero backups
+// the file is just truncated on rotation.
+//
+// Backups are shifted (and optionally compressed to path.N.gz, see SetCompression)
+// in a background goroutine. SetMaxAge, SetMaxCount and SetMaxTotalSize limit
+// the kept backups further.
+func NewRotatingFile(path string, maxsize int64, backups int) (*RotatingFile, error) {
+	if maxsize <= 0 {
+		return nil, errors.New(_ERROR_MESSAGE_FILE_MAX_SIZE)
+	}
+	rf := &RotatingFile{
+		path:    path,
+		maxsize: maxsize,
+		backups: max(backups, 0),
+	}
+	if err := rf.open(_FILE_OPEN_FLAGS); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+// Write implements io.Writer. The file is rotated before writing if its size
+// would exceed the limit (p is never split, so a single write larger than the
+// limit goes to a new file as a whole).
+func (rf *RotatingFile) Write(p []byte) (n int, err error) {
+	rf.mtx.Lock()
+	defer rf.mtx.Unlock()
+	if rf.closed {
+		return 0, errors.New(_ERROR_MESSAGE_FILE_CLOSED)
+	}
+	if rf.file == nil {
+		// previous rotation failed, try to continue with the same path
+		if err = rf.open(_FILE_OPEN_FLAGS); err != nil {
+			return 0, err
+		}
+	}
+	if rf.size > 0 && rf.size+int64(len(p)) > rf.maxsize {
+		if err = rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err = rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// Rotate forces rotation of the current file regardless of its size.
+func (rf *RotatingFile) Rotate() error {
+	rf.mtx.Lock()
+	defer rf.mtx.Unlock()
+	if rf.closed {
+		return errors.New(_ERROR_MESSAGE_FILE_CLOSED)
+	}
+	return rf.rotate()
+}
+
+// Close closes the current file and waits for background processing of backups.
+// Any further writes return an error.
+func (rf *RotatingFile) Close() (err error) {
+	rf.mtx.Lock()
+	if rf.file != nil {
+		err = rf.file.Close()
+		rf.file = nil
+	}
+	rf.closed = true
+	rf.mtx.Unlock()
+	rf.queue.flush()
+	return err
+}
+
+// Commits the current file to the storage (see Logger.Flush).
+func (rf *RotatingFile) Sync() error {
+	rf.mtx.Lock()
+	defer rf.mtx.Unlock()
+	if rf.file == nil {
+		return nil
+	}
+	return rf.file.Sync()
+}
+
+// Returns the path of the current file.
+func (rf *RotatingFile) Name() string {
+	return rf.path
+}
+
+// Returns the path of the backup with the specified number.
+func (rf *RotatingFile) backupName(num int) string {
+	return rf.path + "." + strconv.Itoa(num)
+}
+
+// Opens the current file with the specified flags and gets its size.
+func (rf *RotatingFile) open(flags int) error {
+	f, err := os.OpenFile(rf.path, flags, DEFAULT_FILE_MODE)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	rf.file = f
+	rf.size = info.Size()
+	return nil
+}
+
+// Closes the current file, renames it to a pending name and opens a new empty
+// file. Pending file is moved to backups in background (see shift). With zero
+// backups the file is just truncated. Must be called with the mutex held.
+//
+// On error the writer is left without file and the next Write tries to reopen it.
+func (rf *RotatingFile) rotate() error {
+	if rf.file != nil {
+		err := rf.file.Close()
+		rf.file = nil
+		if err != nil {
+			return err
+		}
+	}
+	if rf.backups > 0 {
+		pending, compress := pendingName(rf.path), rf.compressed()
+		if err := os.Rename(rf.path, pending); err == nil {
+			rf.queue.push(func() { rf.shift(pending, compress) })
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return rf.open(_FILE_OPEN_FLAGS | os.O_TRUNC)
+}
+
+// Shifts backups (path.N-1 -> path.N, ..., pending -> path.1, with or without .gz
+// extension), compresses the new backup if enabled and prunes old ones. Runs in
+// the background goroutine, errors are reported and do not stop processing (the
+// pending file is kept if it can't be moved).
+func (rf *RotatingFile) shift(pending string, compress bool) {
+	for _, ext := range []string{"", _GZIP_EXT} {
+		err := os.Remove(rf.backupName(rf.backups) + ext)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			rf.report(err)
+		}
+		for i := rf.backups - 1; i > 0; i-- {
+			err = os.Rename(rf.backupName(i)+ext, rf.backupName(i+1)+ext)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				rf.report(err)
+			}
+		}
+	}
+	if compress {
+		err := gzipFile(pending, rf.backupName(1)+_GZIP_EXT)
+		if err == nil {
+			pending = ""
+		} else {
+			rf.report(err)
+		}
+	}
+	if pending != "" {
+		rf.report(os.Rename(pending, rf.backupName(1)))
+	}
+	segments := make([]segment, 0, 2*rf.backups)
+	for i := 1; i <= rf.backups; i++ {
+		segments = appendSegment(segments, rf.backupName(i))
+		segments = appendSegment(segments, rf.backupName(i)+_GZIP_EXT)
+	}
+	rf.prune(segments)
+}
+
+/////////////////////////////////////////////////////////////////////////////////////////
+
+// TimeRotatingFile is a time-based rotating file output. It is safe for concurrent
+// use, but it is intended to be written by the logger processing goroutine only.
+type TimeRotatingFile struct {
+	fileRetention // compression and retention of previous files
+	mtx           sync.Mutex
+	dir           string        // directory of files (used as is)
+	pattern       string        // file name pattern (time layout)
+	interval      time.Duration // rotation period (0 - only pattern defines file switches)
+	file          *os.File      // nil if closed or failed to open
+	name          string        // current file path
+	period        time.Time     // beginning of the current file period
+	late          *os.File      // previous period file opened for late messages
+	latename      string        // path of the late messages file
+	closed        bool
+}
+
+// Returns a writer that appends to the file with the name built by formatting the
+// beginning of the current rotation period with the last element of the pattern
+// path (time layout, see https://pkg.go.dev/time#Layout, the directory part is used
+// as is). Examples:
+//
+//	NewTimeRotatingFile("app-2006-01-02.log", ROTATE_DAILY)      // app-2025-01-31.log
+//	NewTimeRotatingFile("app-2006-01-02T15.log", ROTATE_HOURLY)  // app-2025-01-31T23.log
+//	NewTimeRotatingFile("app-2006-01-02T1504.log", 15*time.Minute)
+//
+// Periods up to a day are aligned to the local midnight of the message time
+// location, longer ones are aligned to the zero time. With zero interval files are
+// switched every time the formatted name changes.
+//
+// The file for the current time is opened immediately to detect path errors early.
+//
+// Previous files can be compressed to name.gz (see SetCompression) and pruned
+// (SetMaxAge, SetMaxCount, SetMaxTotalSize) in a background goroutine. Only files
+// in the directory whose names match the pattern are pruned.
+func NewTimeRotatingFile(pattern string, interval time.Duration) (*TimeRotatingFile, error) {
+	rf := &TimeRotatingFile{
+		dir:      filepath.Dir(pattern),
+		pattern:  filepath.Base(pattern),
+		interval: max(interval, 0),
+	}
+	now := time.Now()
+	if err := rf.open(rf.fileName(now), periodStart(now, rf.interval)); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+// Write implements io.Writer. Current time is used to choose the file.
+func (rf *TimeRotatingFile) Write(p []byte) (n int, err error) {
+	return rf.WriteTimed(p, time.Now())
+}
+
+// WriteTimed implements TimedWriter. The file is chosen by the provided time
+// (i.e. the time the message was queued). Messages of periods before the current
+// one are appended to their files without switching the current file.
+func (rf *TimeRotatingFile) WriteTimed(p []byte, t time.Time) (n int, err error) {
+	rf.mtx.Lock()
+	defer rf.mtx.Unlock()
+	if rf.closed {
+		return 0, errors.New(_ERROR_MESSAGE_FILE_CLOSED)
+	}
+	name, start := rf.fileName(t), periodStart(t, rf.interval)
+	switch {
+	case rf.file != nil && name == rf.name:
+	case name != rf.name && start.Before(rf.period):
+		return rf.writeLate(name, p)
+	default:
+		if err = rf.open(name, start); err != nil {
+			return 0, err
+		}
+	}
+	return rf.file.Write(p)
+}
+
+// Close closes the current file and waits for background processing of previous
+// files. Any further writes return an error.
+func (rf *TimeRotatingFile) Close() (err error) {
+	rf.mtx.Lock()
+	rf.closeLate()
+	if rf.file != nil {
+		err = rf.file.Close()
+		rf.file = nil
+	}
+	rf.closed = true
+	rf.mtx.Unlock()
+	rf.queue.flush()
+	return err
+}
+
+// Commits the current file (and the late messages file) to the storage (see
+// Logger.Flush).
+func (rf *TimeRotatingFile) Sync() error {
+	rf.mtx.Lock()
+	defer rf.mtx.Unlock()
+	if rf.late != nil {
+		if err := rf.late.Sync(); err != nil {
+			return err
+		}
+	}
+	if rf.file == nil {
+		return nil
+	}
+	return rf.file.Sync()
+}
+
+// SameDestination implements TimedSplitter: reports whether messages queued at
+// times a and b are written to the same file.
+func (rf *TimeRotatingFile) SameDestination(a, b time.Time) bool {
+	return rf.fileName(a) == rf.fileName(b)
+}
+
+// Returns the path of the current file (of the latest period written).
+func (rf *TimeRotatingFile) Name() string {
+	rf.mtx.Lock()
+	defer rf.mtx.Unlock()
+	return rf.name
+}
+
+// Returns the file path for the rotation period containing t.
+func (rf *TimeRotatingFile) fileName(t time.Time) string {
+	return filepath.Join(rf.dir, periodStart(t, rf.interval).Format(rf.pattern))
+}
+
+// Closes the current file (if any) and opens the specified one of the period
+// starting at start for appending. The previous file is retired only when moving
+// forward in time. Must be called with the mutex held.
+func (rf *TimeRotatingFile) open(name string, start time.Time) error {
+	if rf.file != nil {
+		err := rf.file.Close()
+		rf.file = nil
+		if err != nil {
+			return err
+		}
+		if name != rf.name && start.After(rf.period) {
+			rf.rotated(rf.name)
+		}
+	}
+	rf.closeLate()
+	f, err := os.OpenFile(name, _FILE_OPEN_FLAGS, DEFAULT_FILE_MODE)
+	if err != nil {
+		return err
+	}
+	rf.file = f
+	rf.name = name
+	rf.period = start
+	return nil
+}
+
+// Appends a late message to the file of a previous period keeping it open for
+// the following late messages of the same period. Must be called with the mutex
+// held.
+func (rf *TimeRotatingFile) writeLate(name string, p []byte) (int, error) {
+	if rf.late == nil || name != rf.latename {
+		rf.closeLate()
+		f, err := os.OpenFile(name, _FILE_OPEN_FLAGS, DEFAULT_FILE_MODE)
+		if err != nil {
+			return 0, err
+		}
+		rf.late, rf.latename = f, name
+	}
+	return rf.late.Write(p)
+}
+
+// Closes the late messages file (if any) and retires it again. Must be called with
+// the mutex held.
+func (rf *TimeRotatingFile) closeLate() {
+	if rf.late == nil {
+		return
+	}
+	if err := rf.late.Close(); err != nil {
+		rf.report(err)
+	}
+	rf.late = nil
+	rf.rotated(rf.latename)
+}
+
+// Schedules background processing of the closed previous file: compression (the
+// file is renamed to a pending name right away, so it is not reopened by late
+// messages) and pruning. Must be called with the mutex held.
+func (rf *TimeRotatingFile) rotated(name string) {
+	pending := ""
+	if rf.compressed() {
+		pending = pendingName(name)
+		if err := os.Rename(name, pending); err != nil {
+			rf.report(err)
+			pending = ""
+		}
+	}
+	rf.queue.push(func() {
+		if pending != "" {
+			// late messages can produce several parts of a file: each one is
+			// appended as a separate gzip member
+			rf.report(gzipFile(pending, name+_GZIP_EXT))
+		}
+		rf.prune(rf.segments())
+	})
+}
+
+// Returns previous files (except the current one) sorted from the newest to the
+// oldest. Files are matched by parsing their names (without .gz) with the pattern.
+func (rf *TimeRotatingFile) segments() []segment {
+	entries, err := os.ReadDir(rf.dir)
+	if err != nil {
+		rf.report(err)
+		return nil
+	}
+	current := rf.Name()
+	segments := make([]segment, 0, len(entries))
+	for _, e := range entries {
+		path := filepath.Join(rf.dir, e.Name())
+		if path == current || !e.Type().IsRegular() {
+			continue
+		}
+		if _, err := time.ParseInLocation(rf.pattern, strings.TrimSuffix(e.Name(), _GZIP_EXT), time.Local); err == nil {
+			segments = appendSegment(segments, path)
+		}
+	}
+	sortSegments(segments)
+	return segments
+}
+
+// Returns the beginning of the interval-long period containing t. Periods up to
+// a day are counted from the midnight of t in its location.
+func periodStart(t time.Time, interval time.Duration) time.Time {
+	switch {
+	case interval <= 0:
+		return t
+	case interval <= ROTATE_DAILY:
+		y, m, d := t.Date()
+		midnight := time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+		return midnight.Add(t.Sub(midnight).Truncate(interval))
+	default:
+		return t.Truncate(interval)
+	}
+}
@@ -0,0 +1,299 @@
+package lgr
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readFileStr(t *testing.T, path string) string {
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err, "error reading "+path)
+	return string(data)
+}
+
+func Test_NewRotatingFile(t *testing.T) {
+	dir := t.TempDir()
+	t.Run("wrong_size", func(t *testing.T) {
+		rf, err := NewRotatingFile(filepath.Join(dir, "a.log"), 0, 1)
+		assert.Nil(t, rf)
+		assert.EqualError(t, err, _ERROR_MESSAGE_FILE_MAX_SIZE)
+	})
+	t.Run("wrong_path", func(t *testing.T) {
+		rf, err := NewRotatingFile(filepath.Join(dir, "no", "such", "dir.log"), 10, 1)
+		assert.Nil(t, rf)
+		assert.Error(t, err)
+	})
+	t.Run("existing_file", func(t *testing.T) {
+		path := filepath.Join(dir, "existing.log")
+		assert.NoError(t, os.WriteFile(path, []byte("12345\n"), DEFAULT_FILE_MODE))
+		rf, err := NewRotatingFile(path, 10, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, path, rf.Name())
+		assert.Equal(t, int64(6), rf.size, "size of existing file is ignored")
+		rf.Write([]byte("6789\n")) // exceeds limit, rotated
+		assert.NoError(t, rf.Close())
+		assert.Equal(t, "12345\n", readFileStr(t, path+".1"))
+		assert.Equal(t, "6789\n", readFileStr(t, path))
+	})
+}
+
+func Test_RotatingFile_Write(t *testing.T) {
+	t.Run("backups", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "app.log")
+		rf, err := NewRotatingFile(path, 20, 2)
+		assert.NoError(t, err)
+		for i := range 8 {
+			n, err := rf.Write([]byte("line #" + strconv.Itoa(i) + "\n")) // 8 bytes
+			assert.NoError(t, err)
+			assert.Equal(t, 8, n)
+		}
+		assert.NoError(t, rf.Close())
+		assert.Equal(t, "line #6\nline #7\n", readFileStr(t, path))
+		assert.Equal(t, "line #4\nline #5\n", readFileStr(t, path+".1"))
+		assert.Equal(t, "line #2\nline #3\n", readFileStr(t, path+".2"))
+		assert.NoFileExists(t, path+".3", "extra backup is kept")
+	})
+	t.Run("no_backups", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "app.log")
+		rf, _ := NewRotatingFile(path, 10, -1)
+		rf.Write([]byte("first\n"))
+		rf.Write([]byte("second\n"))
+		assert.NoError(t, rf.Close())
+		assert.Equal(t, "second\n", readFileStr(t, path))
+		assert.NoFileExists(t, path+".1")
+	})
+	t.Run("oversized_write", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "app.log")
+		rf, _ := NewRotatingFile(path, 4, 3)
+		rf.Write([]byte("a\n"))
+		rf.Write([]byte("longer than limit\n"))
+		rf.Write([]byte("b\n"))
+		rf.Close()
+		assert.Equal(t, "b\n", readFileStr(t, path))
+		assert.Equal(t, "longer than limit\n", readFileStr(t, path+".1"))
+		assert.Equal(t, "a\n", readFileStr(t, path+".2"))
+	})
+	t.Run("closed", func(t *testing.T) {
+		rf, _ := NewRotatingFile(filepath.Join(t.TempDir(), "app.log"), 4, 3)
+		assert.NoError(t, rf.Close())
+		assert.NoError(t, rf.Close(), "error on double close")
+		n, err := rf.Write([]byte("x"))
+		assert.Zero(t, n)
+		assert.EqualError(t, err, _ERROR_MESSAGE_FILE_CLOSED)
+		assert.EqualError(t, rf.Rotate(), _ERROR_MESSAGE_FILE_CLOSED)
+	})
+	t.Run("rotate_failed", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "app.log")
+		rf, _ := NewRotatingFile(path, 100, 1)
+		rf.Write([]byte("a\n"))
+		rf.file.Close() // close error stops rotation
+		assert.Error(t, rf.Rotate())
+		assert.Nil(t, rf.file)
+		n, err := rf.Write([]byte("b\n")) // reopened
+		assert.NoError(t, err)
+		assert.Equal(t, 2, n)
+		rf.Close()
+		assert.Equal(t, "a\nb\n", readFileStr(t, path))
+	})
+	t.Run("shift_failed", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "app.log")
+		rf, _ := NewRotatingFile(path, 100, 1)
+		errs := []string{}
+		rf.setErrorHandler(func(s string) { errs = append(errs, s) })
+		rf.Write([]byte("a\n"))
+		assert.NoError(t, os.Mkdir(path+".1", 0755))            // backup can't be replaced by rename
+		assert.NoError(t, os.WriteFile(path+".1/x", nil, 0644)) // (non-empty directory)
+		assert.NoError(t, rf.Rotate(), "background error returned")
+		rf.Write([]byte("b\n"))
+		rf.Close()
+		assert.Equal(t, "b\n", readFileStr(t, path))
+		assert.NotEmpty(t, errs, "error is not reported")
+		for _, e := range errs {
+			assert.True(t, strings.HasPrefix(e, _ROTATION_ERROR_PFX), e)
+		}
+		pending, _ := filepath.Glob(path + _PENDING_EXT + "*")
+		if assert.Len(t, pending, 1, "rotated data is lost") {
+			assert.Equal(t, "a\n", readFileStr(t, pending[0]))
+		}
+	})
+}
+
+func Test_RotatingFile_Logger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	rf, err := NewRotatingFile(path, 100, 100)
+	assert.NoError(t, err)
+	ferr := &FakeWriter{}
+	l := InitWithParams(LVL_UNKNOWN, ferr, rf)
+	lc := l.NewClient("client")
+	l.Start(0)
+	const count = 200
+	for i := range count {
+		lc.LogInfo("message", Int("n", i))
+	}
+	l.StopAndWait()
+	assert.NoError(t, rf.Close())
+	assert.Empty(t, ferr.buffer)
+	// collect lines from the oldest backup to the current file
+	all := ""
+	files := 0
+	for i := 100; i > 0; i-- {
+		data, err := os.ReadFile(path + "." + strconv.Itoa(i))
+		if err == nil {
+			assert.LessOrEqual(t, len(data), 100, "file is bigger than limit")
+			assert.True(t, strings.HasSuffix(string(data), "\n"), "line is split")
+			all += string(data)
+			files++
+		}
+	}
+	all += readFileStr(t, path)
+	assert.Greater(t, files, 1, "file is not rotated")
+	lines := strings.Split(strings.TrimSuffix(all, "\n"), "\n")
+	assert.Len(t, lines, count)
+	for i, line := range lines {
+		assert.Equal(t, "client:message n="+strconv.Itoa(i), line)
+	}
+}
+
+func Test_periodStart(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	ti := time.Date(2025, 3, 15, 23, 47, 31, 999, loc)
+	tests := []struct {
+		name     string
+		interval time.Duration
+		want     time.Time
+	}{
+		{"zero", 0, ti},
+		{"negative", -time.Hour, ti},
+		{"hourly", ROTATE_HOURLY, time.Date(2025, 3, 15, 23, 0, 0, 0, loc)},
+		{"daily", ROTATE_DAILY, time.Date(2025, 3, 15, 0, 0, 0, 0, loc)},
+		{"15min", 15 * time.Minute, time.Date(2025, 3, 15, 23, 45, 0, 0, loc)},
+		{"5hours", 5 * time.Hour, time.Date(2025, 3, 15, 20, 0, 0, 0, loc)},
+		{"week", 7 * ROTATE_DAILY, ti.Truncate(7 * ROTATE_DAILY)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.True(t, tt.want.Equal(periodStart(ti, tt.interval)), periodStart(ti, tt.interval).String())
+		})
+	}
+}
+
+func Test_TimeRotatingFile(t *testing.T) {
+	t.Run("wrong_path", func(t *testing.T) {
+		rf, err := NewTimeRotatingFile(filepath.Join(t.TempDir(), "no", "app-2006.log"), ROTATE_DAILY)
+		assert.Nil(t, rf)
+		assert.Error(t, err)
+		rf, err = NewTimeRotatingFile(filepath.Join(t.TempDir(), "2006-01-02"), ROTATE_DAILY)
+		assert.NoError(t, err, "layout is substituted in directory")
+		rf.Close()
+	})
+	t.Run("daily", func(t *testing.T) {
+		dir := t.TempDir()
+		rf, err := NewTimeRotatingFile(filepath.Join(dir, "app-2006-01-02.log"), ROTATE_DAILY)
+		assert.NoError(t, err)
+		assert.Equal(t, filepath.Join(dir, time.Now().Format("app-2006-01-02.log")), rf.Name())
+		day1 := time.Date(2030, 12, 31, 23, 59, 59, 0, time.Local)
+		day2 := day1.Add(time.Second)
+		rf.WriteTimed([]byte("a\n"), day1)
+		rf.WriteTimed([]byte("b\n"), day2)
+		rf.WriteTimed([]byte("c\n"), day1) // late message goes to its own day
+		assert.Equal(t, filepath.Join(dir, "app-2031-01-01.log"), rf.Name(), "late message switched the file")
+		rf.WriteTimed([]byte("d\n"), day2)
+		n, err := rf.Write([]byte("now\n"))
+		assert.NoError(t, err)
+		assert.Equal(t, 4, n)
+		assert.NoError(t, rf.Close())
+		assert.Equal(t, "a\nc\n", readFileStr(t, filepath.Join(dir, "app-2030-12-31.log")))
+		assert.Equal(t, "b\nd\n", readFileStr(t, filepath.Join(dir, "app-2031-01-01.log")))
+		assert.Equal(t, "now\n", readFileStr(t, filepath.Join(dir, time.Now().Format("app-2006-01-02.log"))))
+	})
+	t.Run("closed", func(t *testing.T) {
+		rf, _ := NewTimeRotatingFile(filepath.Join(t.TempDir(), "app-2006.log"), ROTATE_HOURLY)
+		assert.NoError(t, rf.Close())
+		assert.NoError(t, rf.Close(), "error on double close")
+		n, err := rf.Write([]byte("x"))
+		assert.Zero(t, n)
+		assert.EqualError(t, err, _ERROR_MESSAGE_FILE_CLOSED)
+	})
+	t.Run("late_compressed", func(t *testing.T) {
+		dir := t.TempDir()
+		rf, _ := NewTimeRotatingFile(filepath.Join(dir, "app-2006-01-02.log"), ROTATE_DAILY)
+		rf.SetCompression(true)
+		day1 := time.Date(2030, 1, 1, 12, 0, 0, 0, time.Local)
+		day2 := day1.AddDate(0, 0, 1)
+		rf.WriteTimed([]byte("a\n"), day1)
+		rf.WriteTimed([]byte("b\n"), day2)
+		rf.WriteTimed([]byte("c\n"), day1) // late
+		rf.WriteTimed([]byte("d\n"), day1)
+		rf.WriteTimed([]byte("e\n"), day2)
+		assert.NoError(t, rf.Close())
+		assert.Equal(t, "b\ne\n", readFileStr(t, filepath.Join(dir, "app-2030-01-02.log")))
+		assert.NoFileExists(t, filepath.Join(dir, "app-2030-01-02.log.gz"), "current file is retired by late message")
+		assert.NoFileExists(t, filepath.Join(dir, "app-2030-01-01.log"))
+		assert.Equal(t, "a\nc\nd\n", readGzipStr(t, filepath.Join(dir, "app-2030-01-01.log.gz")))
+	})
+	t.Run("open_failed", func(t *testing.T) {
+		dir := t.TempDir()
+		rf, _ := NewTimeRotatingFile(filepath.Join(dir, "2006"), ROTATE_DAILY)
+		defer rf.Close()
+		assert.NoError(t, os.Mkdir(filepath.Join(dir, "3000"), 0755))
+		n, err := rf.WriteTimed([]byte("x"), time.Date(3000, 1, 1, 0, 0, 0, 0, time.Local))
+		assert.Zero(t, n)
+		assert.Error(t, err, "no error on writing to directory")
+		assert.Nil(t, rf.file)
+		n, err = rf.WriteTimed([]byte("x"), time.Date(3001, 1, 1, 0, 0, 0, 0, time.Local))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, n)
+	})
+}
+
+func Test_TimeRotatingFile_Logger(t *testing.T) {
+	dir := t.TempDir()
+	rf, err := NewTimeRotatingFile(filepath.Join(dir, "app-2006-01-02T15.log"), ROTATE_HOURLY)
+	assert.NoError(t, err)
+	ferr := &FakeWriter{}
+	l := InitWithParams(LVL_UNKNOWN, ferr, rf)
+	l.msgbuf = bytes.NewBuffer(make([]byte, DEFAULT_OUT_BUFF))
+	lc := l.NewClient("c")
+	before := time.Date(2030, 6, 1, 9, 59, 59, 0, time.Local)
+	after := before.Add(time.Second)
+	// the message queued before the hour boundary but proceeded after it
+	for _, pushed := range []time.Time{before, after, before} {
+		msg := makeTextMessage(lc, LVL_INFO, []byte(pushed.Format(time.TimeOnly)))
+		msg.pushed = pushed
+		assert.NoError(t, l.proceedMsg(msg))
+	}
+	assert.NoError(t, rf.Close())
+	assert.Empty(t, ferr.buffer)
+	assert.Equal(t, "c:09:59:59\nc:09:59:59\n", readFileStr(t, filepath.Join(dir, "app-2030-06-01T09.log")))
+	assert.Equal(t, "c:10:00:00\n", readFileStr(t, filepath.Join(dir, "app-2030-06-01T10.log")))
+}
+
+func Test_TimeRotatingFile_Batching(t *testing.T) {
+	dir := t.TempDir()
+	rf, _ := NewTimeRotatingFile(filepath.Join(dir, "app-2006-01-02T15.log"), ROTATE_HOURLY)
+	l := InitWithParams(LVL_UNKNOWN, &FakeWriter{}, rf)
+	l.SetOutputBatching(rf, 1<<20, time.Hour)
+	l.msgbuf = bytes.NewBuffer(make([]byte, DEFAULT_OUT_BUFF))
+	lc := l.NewClient("c")
+	before := time.Date(2030, 6, 1, 9, 59, 59, 0, time.Local)
+	after := before.Add(time.Second)
+	for _, pushed := range []time.Time{before, before, after, after} {
+		msg := makeTextMessage(lc, LVL_INFO, []byte(pushed.Format(time.TimeOnly)))
+		msg.pushed = pushed
+		assert.NoError(t, l.proceedMsg(msg))
+	}
+	assert.Equal(t, "c:09:59:59\nc:09:59:59\n", readFileStr(t, filepath.Join(dir, "app-2030-06-01T09.log")), "batch is not written at the period end")
+	l.flushBatches(true)
+	assert.NoError(t, rf.Close())
+	assert.Equal(t, "c:10:00:00\nc:10:00:00\n", readFileStr(t, filepath.Join(dir, "app-2030-06-01T10.log")))
+	assert.True(t, rf.SameDestination(after, after.Add(time.Hour-time.Second)))
+	assert.False(t, rf.SameDestination(before, after))
+}
@@ -0,0 +1,90 @@
+package lgr
+
+/*
+Shutdown with a deadline.
+
+Logger.Shutdown stops the logger like StopAndWait, but waits for the queued
+messages to be written only until the context is done. Then the logger is
+switched to the abandon mode:
+  - messages left in the queue are removed without writing (Flush barriers
+    among them get an error)
+  - the processing goroutine skips messages and pending batches instead of
+    writing them, async output writers skip their queued messages
+  - the number of abandoned messages is written to the fallback
+
+Writes in progress can't be interrupted, so the processing goroutine (or the
+writer of a hung output) may still be running when Shutdown returns.
+*/
+
+import (
+	"context"
+	"errors"
+	"strconv"
+)
+
+const (
+	_ERROR_MESSAGE_MSG_ABANDONED = "log message abandoned on shutdown"
+	_ABANDONED_NOTICE_SUFFIX     = " log messages abandoned on shutdown"
+)
+
+// Stops the logger and waits until the queued messages are written or the context
+// is done. In the latter case the rest of the messages are abandoned: their number
+// is written to the fallback and returned in the error (caused by the context error).
+//
+// Preferred usage example:
+//
+//	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+//	defer cancel()
+//	if err := logger.Shutdown(ctx); err != nil {
+//	    ...
+//	}
+func (l *Logger) Shutdown(ctx context.Context) error {
+	l.sync.statMtx.RLock()
+	channel, done := l.channel, l.procEnd
+	l.sync.statMtx.RUnlock()
+	// the counter is never reset: messages abandoned by previous shutdowns are excluded
+	before := l.abandoned.Load()
+	if done == nil {
+		// never started
+		return nil
+	}
+	l.Stop()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+	l.abandon.Store(true)
+	// the channel is closed by Stop, so the loop ends once it is empty
+	for msg := range channel {
+		if msg.protect {
+			l.overflow.protected.Add(-1)
+		}
+		l.abandonMessage(&msg)
+	}
+	n := l.abandoned.Load() - before
+	text := strconv.FormatUint(n, 10) + _ABANDONED_NOTICE_SUFFIX
+	l.handleLogWriteError(text)
+	return &causedError{"logger shutdown: " + text + ": " + ctx.Err().Error(), ctx.Err()}
+}
+
+// Counts an abandoned message (text messages only) and fails barrier commands.
+func (l *Logger) abandonMessage(msg *logMessage) {
+	switch {
+	case msg.msgtype == _MSG_LOG_TEXT:
+		l.abandoned.Add(1)
+	case msg.done != nil:
+		msg.done <- errors.New(_ERROR_MESSAGE_MSG_ABANDONED)
+	}
+}
+
+// Counts and removes pending batches (called by the processing goroutine only).
+func (l *Logger) abandonBatches() {
+	for output, context := range l.batched {
+		l.abandoned.Add(uint64(len(context.batch.msgs)))
+		context.batch.buf.Reset()
+		clear(context.batch.msgs)
+		context.batch.msgs = context.batch.msgs[:0]
+		delete(l.batched, output)
+	}
+}
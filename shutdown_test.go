@@ -0,0 +1,103 @@
+package lgr
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Logger_Shutdown(t *testing.T) {
+	out := &FakeWriter{}
+	l := InitWithParams(LVL_UNKNOWN, &FakeWriter{}, out)
+	assert.NoError(t, l.Shutdown(context.Background()), "not started logger")
+	lc := l.NewClient("")
+	l.Start(4)
+	lc.LogInfo("a")
+	lc.LogInfo("b")
+	assert.NoError(t, l.Shutdown(context.Background()))
+	assert.Equal(t, STATE_STOPPED, l.state)
+	assert.Equal(t, ":a\n:b\n", out.String())
+	assert.Zero(t, l.abandoned.Load())
+}
+
+func Test_Logger_Shutdown_Deadline(t *testing.T) {
+	out, ferr := NewGateWriter(), &FakeWriter{}
+	l := InitWithParams(LVL_UNKNOWN, ferr, out)
+	lc := l.NewClient("")
+	l.Start(8)
+	for _, s := range []string{"a", "b", "c", "d", "e"} {
+		lc.LogInfo(s)
+	}
+	// "a" is being written, the rest and the barrier are queued
+	assert.Eventually(t, func() bool { return len(l.channel) == 4 }, time.Second, time.Millisecond)
+	flushed := make(chan error)
+	go func() { flushed <- l.Flush(context.Background()) }()
+	assert.Eventually(t, func() bool { return len(l.channel) == 5 }, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := l.Shutdown(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorContains(t, err, "4"+_ABANDONED_NOTICE_SUFFIX)
+	assert.ErrorContains(t, <-flushed, _ERROR_MESSAGE_MSG_ABANDONED)
+	assert.Contains(t, ferr.String(), "4"+_ABANDONED_NOTICE_SUFFIX)
+
+	out.Open()
+	l.Wait()
+	assert.Equal(t, ":a\n", out.String(), "abandoned messages are written")
+	assert.False(t, l.IsActive())
+
+	l.Start(8) // restart resets the abandon mode
+	lc.LogInfo("f")
+	l.StopAndWait()
+	assert.Equal(t, ":a\n:f\n", out.String())
+}
+
+func Test_Logger_Shutdown_Repeated(t *testing.T) {
+	ferr := &FakeWriter{}
+	l := InitWithParams(LVL_UNKNOWN, ferr)
+	lc := l.NewClient("")
+	for _, n := range []int{3, 2} {
+		out := NewGateWriter()
+		l.AddOutputs(out)
+		l.Start(8)
+		for range n + 1 {
+			lc.LogInfo("x")
+		}
+		// the first message is being written, the rest are queued
+		assert.Eventually(t, func() bool { return len(l.channel) == n }, time.Second, time.Millisecond)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		err := l.Shutdown(ctx)
+		cancel()
+		assert.ErrorContains(t, err, ": "+strconv.Itoa(n)+_ABANDONED_NOTICE_SUFFIX, "cumulative count")
+		out.Open()
+		l.Wait()
+		l.RemoveOutputs(out)
+	}
+	assert.Contains(t, ferr.String(), "2"+_ABANDONED_NOTICE_SUFFIX)
+	assert.NotContains(t, ferr.String(), "5"+_ABANDONED_NOTICE_SUFFIX)
+}
+
+func Test_Logger_Shutdown_Outputs(t *testing.T) {
+	slow, batched := NewGateWriter(), &FakeWriter{}
+	l := InitWithParams(LVL_UNKNOWN, &FakeWriter{}, slow, batched)
+	l.SetOutputAsync(slow, 8).SetOutputBatching(batched, 1<<20, 0)
+	lc := l.NewClient("")
+	l.Start(8)
+	for range 3 {
+		lc.LogInfo("x")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Error(t, l.Shutdown(ctx), "async output is not waited")
+	slow.Open()
+	l.Wait()
+	// the batch is written on the processing goroutine exit (before the deadline),
+	// the async writer is stalled writing the first message
+	assert.Equal(t, ":x\n:x\n:x\n", batched.String())
+	assert.Equal(t, ":x\n", slow.String(), "abandoned messages are written")
+	assert.Equal(t, uint64(2), l.abandoned.Load())
+}
@@ -0,0 +1,176 @@
+package lgr
+
+/*
+log/slog adapter.
+
+SlogHandler routes slog records through a LogClient, so slog loggers share the
+lgr queue, global/client/output level filtering, statistics and fallback error
+handling. Levels are mapped by LevelFromSlog, attributes are converted to typed
+structured fields. Groups are flattened into dotted keys ("req.id=5"), like the
+slog text handler does.
+
+WithAttrs and WithGroup return derived handlers routed through derived clients
+of the same logger: WithGroup("db") of the "app" client creates the "app.db"
+client, WithAttrs creates a client with the same name. A derived client starts
+with the min level and enabled setting of its parent and can be managed
+separately (see SlogHandler.Client).
+
+Example:
+
+	slog.SetDefault(slog.New(lgr.NewSlogHandler(logger.NewClient("app"))))
+	slog.Info("login", "user", u, slog.Group("req", "id", id))
+
+	db := slog.New(slog.Default().Handler().WithGroup("db"))
+	logger.SetClientMinLevel(db.Handler().(*lgr.SlogHandler).Client(), lgr.LVL_WARN)
+*/
+
+import (
+	"context"
+	"log/slog"
+)
+
+// SlogHandler is an slog.Handler writing records to a LogClient.
+type SlogHandler struct {
+	client *LogClient
+	name   string  // client name the derived clients names are built from
+	fields []Field // attributes added by WithAttrs (with group prefixes)
+	prefix string  // key prefix of the groups opened by WithGroup ("a.b.")
+}
+
+// Creates an slog.Handler routing records through the client. The record time
+// and source are not used: the message time is the time it is queued.
+func NewSlogHandler(client *LogClient) *SlogHandler {
+	h := &SlogHandler{client: client}
+	if client != nil {
+		h.name = string(client.name)
+	}
+	return h
+}
+
+// Returns the client the handler routes records through (the derived one for
+// handlers returned by WithAttrs and WithGroup).
+func (h *SlogHandler) Client() *LogClient {
+	return h.client
+}
+
+// Maps an slog level to the log level: levels below slog.LevelDebug are mapped
+// to LVL_TRACE, levels between the standard ones to the lower one, and levels
+// above slog.LevelError to LVL_ERROR.
+func LevelFromSlog(level slog.Level) LogLevel {
+	switch {
+	case level < slog.LevelDebug:
+		return LVL_TRACE
+	case level < slog.LevelInfo:
+		return LVL_DEBUG
+	case level < slog.LevelWarn:
+		return LVL_INFO
+	case level < slog.LevelError:
+		return LVL_WARN
+	default:
+		return LVL_ERROR
+	}
+}
+
+// Reports whether a record of the level would be written by at least one output
+// (see LogClient.Enabled).
+func (h *SlogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.client.Enabled(LevelFromSlog(level))
+}
+
+// Queues the record as a log message with the attributes as structured fields.
+// Returns the queuing error (e.g. ErrMessageDropped or inactive logger error).
+func (h *SlogHandler) Handle(_ context.Context, r slog.Record) error {
+	if h.client == nil {
+		return nil
+	}
+	fields := h.fields
+	if r.NumAttrs() > 0 {
+		fields = make([]Field, len(h.fields), len(h.fields)+r.NumAttrs())
+		copy(fields, h.fields)
+		r.Attrs(func(a slog.Attr) bool {
+			fields = appendSlogAttr(fields, h.prefix, a)
+			return true
+		})
+	}
+	_, err := h.client.Log_with_err(LevelFromSlog(r.Level), r.Message, fields...)
+	return err
+}
+
+// Returns a derived handler adding the attributes to every record. The handler
+// routes records through a new client with the same name.
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	derived := h.derive(h.name)
+	derived.fields = make([]Field, len(h.fields), len(h.fields)+len(attrs))
+	copy(derived.fields, h.fields)
+	for _, a := range attrs {
+		derived.fields = appendSlogAttr(derived.fields, h.prefix, a)
+	}
+	return derived
+}
+
+// Returns a derived handler qualifying keys of the following attributes with
+// the group name. The handler routes records through a new client named
+// "parent.group" (or just "group" if the parent name is empty).
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clientname := name
+	if h.name != "" {
+		clientname = h.name + "." + name
+	}
+	derived := h.derive(clientname)
+	derived.prefix += name + "."
+	return derived
+}
+
+// Returns a copy of the handler with a new client of the same logger named name
+// and inheriting the min level and enabled setting of the handler client.
+func (h *SlogHandler) derive(name string) *SlogHandler {
+	derived := *h
+	derived.name = name
+	if lc := h.client; lc != nil && lc.logger != nil {
+		derived.client = lc.logger.NewClientWithLevel(name, lc.minLevel)
+		derived.client.enabled = lc.enabled
+	}
+	return &derived
+}
+
+// Converts an attribute (resolving LogValuer values) into fields appended to the
+// slice. Empty attributes and groups are skipped, groups with empty keys are inlined.
+func appendSlogAttr(fields []Field, prefix string, a slog.Attr) []Field {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return fields
+	}
+	key := prefix + a.Key
+	switch a.Value.Kind() {
+	case slog.KindGroup:
+		if a.Key != "" {
+			prefix = key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			fields = appendSlogAttr(fields, prefix, ga)
+		}
+		return fields
+	case slog.KindString:
+		return append(fields, Str(key, a.Value.String()))
+	case slog.KindInt64:
+		return append(fields, Int64(key, a.Value.Int64()))
+	case slog.KindUint64:
+		return append(fields, Uint64(key, a.Value.Uint64()))
+	case slog.KindFloat64:
+		return append(fields, Float64(key, a.Value.Float64()))
+	case slog.KindBool:
+		return append(fields, Bool(key, a.Value.Bool()))
+	case slog.KindDuration:
+		return append(fields, Duration(key, a.Value.Duration()))
+	case slog.KindTime:
+		return append(fields, Time(key, a.Value.Time()))
+	default:
+		return append(fields, Any(key, a.Value.Any()))
+	}
+}
@@ -0,0 +1,95 @@
+package lgr
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type slogToken string
+
+func (s slogToken) LogValue() slog.Value {
+	return slog.StringValue("***")
+}
+
+func Test_LevelFromSlog(t *testing.T) {
+	tests := []struct {
+		level slog.Level
+		want  LogLevel
+	}{
+		{slog.LevelDebug - 4, LVL_TRACE},
+		{slog.LevelDebug, LVL_DEBUG},
+		{slog.LevelDebug + 1, LVL_DEBUG},
+		{slog.LevelInfo, LVL_INFO},
+		{slog.LevelWarn, LVL_WARN},
+		{slog.LevelError, LVL_ERROR},
+		{slog.LevelError + 8, LVL_ERROR},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, LevelFromSlog(tt.level), tt.level.String())
+	}
+}
+
+func Test_SlogHandler(t *testing.T) {
+	out := &FakeWriter{}
+	l := InitWithParams(LVL_UNKNOWN, &FakeWriter{}, out)
+	lc := l.NewClient("s")
+	logger := slog.New(NewSlogHandler(lc))
+	l.Start(8)
+	logger.Info("plain")
+	logger.Warn("kinds", "s", "x", "i", -1, "u", uint64(2), "f", 1.5, "b", true,
+		"d", time.Second, "e", errors.New("oops"), "t", slogToken("secret"), slog.Attr{})
+	logger.With("a", 1).WithGroup("req").With("id", 5).WithGroup("empty").
+		Info("grouped", slog.Group("user", "name", "bob"), slog.Group("", "inline", 1), slog.Group("none"))
+	logger.WithGroup("").Info("", "only", "fields")
+	l.StopAndWait()
+	assert.Equal(t, "s:plain\n"+
+		"s:kinds s=x i=-1 u=2 f=1.5 b=true d=1s e=oops t=***\n"+
+		"s.req.empty:grouped a=1 req.id=5 req.empty.user.name=bob req.empty.inline=1\n"+
+		"s: only=fields\n", out.String())
+
+	t.Run("derived", func(t *testing.T) {
+		out := &FakeWriter{}
+		l := InitWithParams(LVL_UNKNOWN, &FakeWriter{}, out)
+		lc := l.NewClientWithLevel("app", LVL_DEBUG)
+		parent := NewSlogHandler(lc)
+		db := parent.WithGroup("db").(*SlogHandler)
+		attrs := parent.WithAttrs([]slog.Attr{slog.Int("a", 1)}).(*SlogHandler)
+		assert.Same(t, lc, parent.Client())
+		assert.NotSame(t, lc, db.Client())
+		assert.NotSame(t, lc, attrs.Client())
+		assert.True(t, l.IsOwnClient(db.Client()))
+		assert.Equal(t, LVL_DEBUG, db.Client().minLevel, "parent level is not inherited")
+		assert.Same(t, parent, parent.WithGroup(""), "empty group")
+		assert.Same(t, parent, parent.WithAttrs(nil), "no attributes")
+		db.Client().minLevel = LVL_WARN // as set by SetClientMinLevel
+		l.SetClientEnabled(attrs.Client(), false)
+		l.Start(8)
+		slog.New(parent).Info("p")
+		slog.New(db).Info("skipped")
+		slog.New(db).Warn("w", "k", 1)
+		slog.New(db.WithGroup("sql")).Info("inherited level")
+		slog.New(attrs).Error("disabled")
+		slog.New(attrs.WithGroup("g")).Error("disabled too")
+		slog.New(NewSlogHandler(l.NewClient("")).WithGroup("g")).Info("empty parent name")
+		l.StopAndWait()
+		assert.Equal(t, "app:p\napp.db:w db.k=1\ng:empty parent name\n", out.String())
+	})
+	t.Run("enabled", func(t *testing.T) {
+		h := NewSlogHandler(lc)
+		l.SetMinLevel(LVL_INFO)
+		assert.False(t, h.Enabled(context.Background(), slog.LevelDebug))
+		assert.True(t, h.Enabled(context.Background(), slog.LevelInfo))
+		l.SetClientEnabled(lc, false)
+		assert.False(t, h.Enabled(context.Background(), slog.LevelError), "disabled client")
+		assert.False(t, NewSlogHandler(nil).Enabled(context.Background(), slog.LevelError))
+	})
+	t.Run("error", func(t *testing.T) {
+		err := NewSlogHandler(l.NewClient("")).Handle(context.Background(), slog.NewRecord(time.Now(), slog.LevelError, "x", 0))
+		assert.EqualError(t, err, _ERROR_MESSAGE_LOGGER_INACTIVE)
+	})
+}
@@ -0,0 +1,263 @@
+package lgr
+
+/*
+Logger statistics.
+
+Counters are updated with atomics on the hot paths (client-side filtering and
+queuing, output writes in the processing goroutine) and are read by
+Logger.Stats() as a point-in-time snapshot:
+  - per level message counters for the logger, every client and every output
+  - bytes written, write errors and panics per output
+  - queue depth and capacity
+  - processing latency (the time between queuing and writing to outputs)
+
+Clients are registered by weak pointers, so statistics don't keep unused
+clients alive (collected clients just disappear from snapshots).
+*/
+
+import (
+	"sync/atomic"
+	"time"
+	"weak"
+)
+
+// LevelCounts holds a counter per log level (indexed by LogLevel).
+type LevelCounts [_LVL_MAX_for_checks_only]uint64
+
+// Returns the sum of counters for all levels.
+func (c *LevelCounts) Total() (total uint64) {
+	for _, v := range c {
+		total += v
+	}
+	return total
+}
+
+// MessageStats holds per level message counters of the logger or of a client.
+type MessageStats struct {
+	Enqueued LevelCounts // accepted to the queue
+	Filtered LevelCounts // rejected before queuing (disabled client, logger or client level)
+	Dropped  LevelCounts // dropped on queue overflow (including already queued ones)
+	Written  LevelCounts // successful writes to outputs (once per output)
+}
+
+// ClientStats holds counters of a single client.
+type ClientStats struct {
+	Client *LogClient
+	Name   string // current client name
+	MessageStats
+}
+
+// OutputStats holds counters of a single output.
+type OutputStats struct {
+	Output   OutType
+	Name     string      // see Logger.SetOutputName
+	Enabled  bool        // false if disabled (e.g. automatically after a panic)
+	Written  LevelCounts // successful writes
+	Filtered LevelCounts // skipped by output or logger min level
+	Bytes    uint64      // bytes written
+	Errors   uint64      // write errors (including panics and timeouts)
+	Panics   uint64      // write panics
+	Timeouts uint64      // write timeouts (see Logger.SetOutputWriteTimeout)
+	Dropped  uint64      // dropped on async queue overflow (see Logger.SetOutputAsync)
+}
+
+// LatencyStats describes the time between queuing messages and writing them to
+// outputs (including formatting and writing to all outputs).
+type LatencyStats struct {
+	Count uint64        // number of measured messages
+	Total time.Duration // sum of latencies
+	Max   time.Duration // max latency
+	Last  time.Duration // latency of the last message
+}
+
+// Returns the average latency (zero if nothing is measured).
+func (s LatencyStats) Avg() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Count)
+}
+
+// Stats is a snapshot of the logger statistics (see Logger.Stats).
+type Stats struct {
+	MessageStats               // totals for all clients
+	Clients      []ClientStats // registered (alive) clients
+	Outputs      []OutputStats // current outputs
+	QueueLen     int           // messages waiting in the queue
+	QueueCap     int           // queue capacity (zero if not started)
+	Latency      LatencyStats
+}
+
+// msgCounters is the atomic storage for MessageStats.
+type msgCounters struct {
+	enqueued [_LVL_MAX_for_checks_only]atomic.Uint64
+	filtered [_LVL_MAX_for_checks_only]atomic.Uint64
+	dropped  [_LVL_MAX_for_checks_only]atomic.Uint64
+	written  [_LVL_MAX_for_checks_only]atomic.Uint64
+}
+
+// outCounters is the atomic storage for OutputStats counters.
+type outCounters struct {
+	written  [_LVL_MAX_for_checks_only]atomic.Uint64
+	filtered [_LVL_MAX_for_checks_only]atomic.Uint64
+	bytes    atomic.Uint64
+	errors   atomic.Uint64
+	panics   atomic.Uint64
+	timeouts atomic.Uint64
+	dropped  atomic.Uint64
+}
+
+// latencyCounters is the atomic storage for LatencyStats.
+type latencyCounters struct {
+	count atomic.Uint64
+	total atomic.Int64
+	max   atomic.Int64
+	last  atomic.Int64
+}
+
+// Returns a snapshot of the logger statistics. Counters are read one by one, so
+// the snapshot is not strictly consistent if messages are logged meanwhile.
+func (l *Logger) Stats() (s Stats) {
+	s.MessageStats = l.stats.msgs.snapshot()
+	s.Latency = l.stats.latency.snapshot()
+	l.sync.statMtx.RLock()
+	if l.channel != nil {
+		s.QueueLen, s.QueueCap = len(l.channel), cap(l.channel)
+	}
+	l.sync.statMtx.RUnlock()
+	l.sync.outsMtx.RLock()
+	for output, context := range l.outputs {
+		if context != nil {
+			s.Outputs = append(s.Outputs, context.stats.snapshot(output, context.name, context.enabled))
+		}
+	}
+	l.sync.outsMtx.RUnlock()
+	// exclusive lock: client names are changed by commands under the read lock
+	l.sync.clntMtx.Lock()
+	defer l.sync.clntMtx.Unlock()
+	for _, wp := range l.clients {
+		if lc := wp.Value(); lc != nil {
+			s.Clients = append(s.Clients, ClientStats{
+				Client:       lc,
+				Name:         string(lc.name),
+				MessageStats: lc.stats.snapshot(),
+			})
+		}
+	}
+	return s
+}
+
+// Registers a client for statistics (keeps a weak pointer only). Pointers to
+// collected clients are removed when the registry has to grow.
+func (l *Logger) registerClient(lc *LogClient) {
+	l.sync.clntMtx.Lock()
+	defer l.sync.clntMtx.Unlock()
+	if len(l.clients) == cap(l.clients) {
+		alive := l.clients[:0]
+		for _, wp := range l.clients {
+			if wp.Value() != nil {
+				alive = append(alive, wp)
+			}
+		}
+		clear(l.clients[len(alive):])
+		l.clients = alive
+	}
+	l.clients = append(l.clients, weak.Make(lc))
+}
+
+// Counts a message filtered before queuing.
+func (l *Logger) countFiltered(lc *LogClient, level LogLevel) {
+	l.stats.msgs.filtered[level].Add(1)
+	lc.stats.filtered[level].Add(1)
+}
+
+// Counts a text message accepted to the queue.
+func (l *Logger) countEnqueued(msg *logMessage) {
+	level := normLevel(LogLevel(msg.annex))
+	l.stats.msgs.enqueued[level].Add(1)
+	if msg.msgclnt != nil {
+		msg.msgclnt.stats.enqueued[level].Add(1)
+	}
+}
+
+// Counts a message dropped on overflow.
+func (l *Logger) countDropped(msg *logMessage) {
+	level := normLevel(LogLevel(msg.annex))
+	l.overflow.dropped.Add(1)
+	l.overflow.unreported.Add(1)
+	l.stats.msgs.dropped[level].Add(1)
+	if msg.msgclnt != nil {
+		msg.msgclnt.stats.dropped[level].Add(1)
+	}
+}
+
+// Counts a successful write of a message to an output.
+func (l *Logger) countWritten(context *outContext, msg *logMessage, n int64) {
+	level := normLevel(LogLevel(msg.annex))
+	l.stats.msgs.written[level].Add(1)
+	if msg.msgclnt != nil {
+		msg.msgclnt.stats.written[level].Add(1)
+	}
+	if context != nil {
+		context.stats.written[level].Add(1)
+		context.stats.bytes.Add(uint64(max(n, 0)))
+	}
+}
+
+// Counts a successful write of a batch of messages to an output.
+func (l *Logger) countBatchWritten(context *outContext, msgs []logMessage, n int64) {
+	for i := range msgs {
+		l.countWritten(context, &msgs[i], 0)
+	}
+	context.stats.bytes.Add(uint64(max(n, 0)))
+}
+
+// Records the processing latency of a message.
+func (c *latencyCounters) record(d time.Duration) {
+	c.count.Add(1)
+	c.total.Add(int64(d))
+	c.last.Store(int64(d))
+	for {
+		m := c.max.Load()
+		if int64(d) <= m || c.max.CompareAndSwap(m, int64(d)) {
+			return
+		}
+	}
+}
+
+func (c *latencyCounters) snapshot() LatencyStats {
+	return LatencyStats{
+		Count: c.count.Load(),
+		Total: time.Duration(c.total.Load()),
+		Max:   time.Duration(c.max.Load()),
+		Last:  time.Duration(c.last.Load()),
+	}
+}
+
+func (c *msgCounters) snapshot() (s MessageStats) {
+	for i := range s.Enqueued {
+		s.Enqueued[i] = c.enqueued[i].Load()
+		s.Filtered[i] = c.filtered[i].Load()
+		s.Dropped[i] = c.dropped[i].Load()
+		s.Written[i] = c.written[i].Load()
+	}
+	return s
+}
+
+func (c *outCounters) snapshot(output OutType, name string, enabled bool) OutputStats {
+	s := OutputStats{
+		Output:   output,
+		Name:     name,
+		Enabled:  enabled,
+		Bytes:    c.bytes.Load(),
+		Errors:   c.errors.Load(),
+		Panics:   c.panics.Load(),
+		Timeouts: c.timeouts.Load(),
+		Dropped:  c.dropped.Load(),
+	}
+	for i := range s.Written {
+		s.Written[i] = c.written[i].Load()
+		s.Filtered[i] = c.filtered[i].Load()
+	}
+	return s
+}
@@ -0,0 +1,126 @@
+package lgr
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_LevelCounts_Total(t *testing.T) {
+	c := LevelCounts{}
+	assert.Zero(t, c.Total())
+	c[LVL_INFO], c[LVL_ERROR] = 2, 3
+	assert.Equal(t, uint64(5), c.Total())
+}
+
+func Test_LatencyStats(t *testing.T) {
+	c := latencyCounters{}
+	assert.Zero(t, c.snapshot().Avg())
+	for _, d := range []time.Duration{3, 9, 6} {
+		c.record(d)
+	}
+	s := c.snapshot()
+	assert.Equal(t, LatencyStats{Count: 3, Total: 18, Max: 9, Last: 6}, s)
+	assert.Equal(t, time.Duration(6), s.Avg())
+}
+
+func Test_Logger_Stats(t *testing.T) {
+	out, outerr, outpanic := &FakeWriter{}, &ErrorWriter{}, &PanicWriter{}
+	l := InitWithParams(LVL_DEBUG, &FakeWriter{}, out, outerr, outpanic)
+	l.SetOutputMinLevel(out, LVL_INFO)
+	assert.Zero(t, l.Stats().QueueCap, "capacity of not started logger")
+	lc1 := l.NewClient("one")
+	lc2 := l.NewClientWithLevel("two", LVL_WARN)
+	l.Start(10)
+	t0 := time.Now()
+	lc1.LogTrace("filtered by logger")
+	lc1.LogDebug("filtered by output")
+	lc1.LogInfo("info")
+	lc2.LogInfo("filtered by client")
+	lc2.LogWarn("warn")
+	l.SetClientEnabled(lc2, false)
+	lc2.LogWarn("filtered by disabled client")
+	l.StopAndWait()
+	elapsed := time.Since(t0)
+	s := l.Stats()
+
+	assert.Equal(t, LevelCounts{LVL_DEBUG: 1, LVL_INFO: 1, LVL_WARN: 1}, s.Enqueued)
+	assert.Equal(t, LevelCounts{LVL_TRACE: 1, LVL_INFO: 1, LVL_WARN: 1}, s.Filtered)
+	assert.Zero(t, s.Dropped.Total())
+	assert.Equal(t, LevelCounts{LVL_INFO: 1, LVL_WARN: 1}, s.Written, "only out is written successfully")
+	assert.Equal(t, 10, s.QueueCap)
+	assert.Zero(t, s.QueueLen)
+	assert.Equal(t, uint64(3), s.Latency.Count)
+	assert.Positive(t, s.Latency.Max)
+	assert.LessOrEqual(t, s.Latency.Max, elapsed)
+
+	if assert.Len(t, s.Clients, 2) {
+		byName := map[string]ClientStats{s.Clients[0].Name: s.Clients[0], s.Clients[1].Name: s.Clients[1]}
+		assert.Same(t, lc1, byName["one"].Client)
+		assert.Equal(t, LevelCounts{LVL_DEBUG: 1, LVL_INFO: 1}, byName["one"].Enqueued)
+		assert.Equal(t, LevelCounts{LVL_TRACE: 1}, byName["one"].Filtered)
+		assert.Equal(t, LevelCounts{LVL_INFO: 1}, byName["one"].Written)
+		assert.Equal(t, LevelCounts{LVL_WARN: 1}, byName["two"].Enqueued)
+		assert.Equal(t, LevelCounts{LVL_INFO: 1, LVL_WARN: 1}, byName["two"].Filtered)
+	}
+
+	assert.Len(t, s.Outputs, 3)
+	for _, o := range s.Outputs {
+		switch o.Output {
+		case out:
+			assert.True(t, o.Enabled)
+			assert.Equal(t, LevelCounts{LVL_INFO: 1, LVL_WARN: 1}, o.Written)
+			assert.Equal(t, LevelCounts{LVL_DEBUG: 1}, o.Filtered)
+			assert.Equal(t, uint64(len(out.buffer)), o.Bytes)
+			assert.Zero(t, o.Errors)
+		case outerr:
+			assert.True(t, o.Enabled)
+			assert.Zero(t, o.Written.Total())
+			assert.Equal(t, uint64(3), o.Errors)
+			assert.Zero(t, o.Panics)
+		case outpanic:
+			assert.False(t, o.Enabled, "output is not disabled on panic")
+			assert.Equal(t, uint64(1), o.Errors)
+			assert.Equal(t, uint64(1), o.Panics)
+		default:
+			assert.Fail(t, "unknown output")
+		}
+	}
+}
+
+func Test_Logger_Stats_Dropped(t *testing.T) {
+	l := newStalledLogger(1, OVERFLOW_DROP_OLDEST, 0)
+	lc := l.NewClient("c")
+	lc.LogInfo("a")
+	lc.LogInfo("b") // "a" is dropped
+	lc.LogDebug("d")
+	s := l.Stats()
+	assert.Equal(t, LevelCounts{LVL_INFO: 2}, s.Enqueued)
+	assert.Equal(t, LevelCounts{LVL_INFO: 1, LVL_DEBUG: 1}, s.Dropped)
+	assert.Equal(t, s.Dropped, s.Clients[0].Dropped)
+	assert.Equal(t, 1, s.QueueLen)
+	assert.Equal(t, 1, s.QueueCap)
+}
+
+func Test_Logger_registerClient(t *testing.T) {
+	l := Init()
+	keep := l.NewClient("keep")
+	for range 100 {
+		l.NewClient("temporary")
+	}
+	runtime.GC()
+	for len(l.clients) < cap(l.clients) {
+		l.NewClient("fill")
+	}
+	l.NewClient("trigger") // registry compaction on growth
+	s := l.Stats()
+	assert.Less(t, len(l.clients), 100, "registry is not compacted")
+	found := false
+	for _, c := range s.Clients {
+		found = found || c.Client == keep
+	}
+	assert.True(t, found, "alive client is lost")
+	runtime.KeepAlive(keep)
+}
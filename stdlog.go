@@ -0,0 +1,150 @@
+package lgr
+
+/*
+Standard library log bridge.
+
+StdWriter is an io.Writer for log.Logger (log.New or log.SetOutput) writing
+every call as a log message of the client. Unlike LogClient.Write it has no
+shared mutable level, so it is goroutine-safe (once configured) as required by
+log.Logger. Before queuing a line the writer:
+  - removes the trailing newline added by log.Logger
+  - strips the configured prefix and the date/time header of the std flags
+    (log.Ldate, log.Ltime, log.Lmicroseconds), as lgr adds its own timestamp
+  - optionally takes the level from a leading token like "[WARN]" or "error:"
+    (level names of LevelFullNames and LevelShortNames in any case, and
+    "WARNING"), the default level is used for lines without it
+
+Example (a library accepting only *log.Logger):
+
+	lib.SetLogger(lgr.NewStdLogger(logger.NewClient("lib"), lgr.LVL_INFO, true))
+*/
+
+import (
+	"bytes"
+	"log"
+	"strings"
+)
+
+const _STD_LEVEL_TOKEN_MAX = 12 // max length of a level token (to skip long words quickly)
+
+// Level tokens recognized by StdWriter (upper case).
+var stdLevelTokens = func() map[string]LogLevel {
+	tokens := map[string]LogLevel{"WARNING": LVL_WARN}
+	for level := LVL_TRACE; level < _LVL_MAX_for_checks_only; level++ {
+		tokens[LevelFullNames[level]] = level
+		tokens[LevelShortNames[level]] = level
+	}
+	return tokens
+}()
+
+// StdWriter is a goroutine-safe io.Writer bridging the standard log package to a
+// LogClient (see NewStdWriter).
+type StdWriter struct {
+	client *LogClient
+	level  LogLevel // level of lines without a level token
+	prefix []byte   // log.Logger prefix to strip
+	parse  bool     // whether to parse level tokens
+}
+
+// Creates a writer for log.Logger writing lines as messages of the client with the
+// provided level. Settings must be changed by Set methods before the writer is used.
+func NewStdWriter(client *LogClient, level LogLevel) *StdWriter {
+	return &StdWriter{client: client, level: normLevel(level)}
+}
+
+// Creates a log.Logger (without prefix and flags) writing to the client through a
+// StdWriter with the provided default level and level tokens parsing.
+func NewStdLogger(client *LogClient, level LogLevel, parseLevels bool) *log.Logger {
+	return log.New(NewStdWriter(client, level).SetParseLevels(parseLevels), "", 0)
+}
+
+// Sets the prefix of the log.Logger to strip from lines (before or after the
+// date/time header, see log.Lmsgprefix).
+func (w *StdWriter) SetPrefix(prefix string) *StdWriter {
+	w.prefix = []byte(prefix)
+	return w
+}
+
+// Enables or disables taking the message level from a leading level token.
+func (w *StdWriter) SetParseLevels(parse bool) *StdWriter {
+	w.parse = parse
+	return w
+}
+
+// Write implements io.Writer: the line is queued as a log message (the data is
+// copied, log.Logger reuses its buffer). Returns len(p) or the queuing error.
+func (w *StdWriter) Write(p []byte) (n int, err error) {
+	line := bytes.TrimSuffix(p, []byte("\n"))
+	line = bytes.TrimPrefix(line, w.prefix)
+	line = skipStdHeader(line)
+	line = bytes.TrimPrefix(line, w.prefix)
+	level := w.level
+	if w.parse {
+		if lvl, rest, ok := parseLevelToken(line); ok {
+			level, line = lvl, rest
+		}
+	}
+	if _, err = w.client.LogBytes_with_err(level, bytes.Clone(line)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Skips the date ("2006/01/02 ") and time ("15:04:05 " or "15:04:05.000000 ")
+// written by log.Logger flags.
+func skipStdHeader(line []byte) []byte {
+	if matchDigits(line, "dddd/dd/dd ") {
+		line = line[11:]
+	}
+	if matchDigits(line, "dd:dd:dd") {
+		rest := line[8:]
+		if len(rest) > 0 && rest[0] == '.' {
+			rest = bytes.TrimLeft(rest[1:], "0123456789")
+		}
+		if len(rest) > 0 && rest[0] == ' ' {
+			line = rest[1:]
+		}
+	}
+	return line
+}
+
+// Reports whether the data starts with the pattern ('d' matches any digit).
+func matchDigits(data []byte, pattern string) bool {
+	if len(data) < len(pattern) {
+		return false
+	}
+	for i := range len(pattern) {
+		if pattern[i] == 'd' {
+			if data[i] < '0' || data[i] > '9' {
+				return false
+			}
+		} else if data[i] != pattern[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Parses a leading level token ("[WARN] text" or "warn: text"). Returns the level
+// and the rest of the line without leading spaces.
+func parseLevelToken(line []byte) (level LogLevel, rest []byte, ok bool) {
+	var token []byte
+	if len(line) > 0 && line[0] == '[' {
+		end := bytes.IndexByte(line, ']')
+		if end < 0 {
+			return
+		}
+		token, rest = line[1:end], line[end+1:]
+	} else {
+		end := bytes.IndexByte(line, ':')
+		if end < 0 {
+			return
+		}
+		token, rest = line[:end], line[end+1:]
+	}
+	if len(token) > _STD_LEVEL_TOKEN_MAX {
+		return
+	}
+	level, ok = stdLevelTokens[strings.ToUpper(string(token))]
+	return level, bytes.TrimLeft(rest, " "), ok
+}
@@ -0,0 +1,80 @@
+package lgr
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseLevelToken(t *testing.T) {
+	tests := []struct {
+		line  string
+		level LogLevel
+		rest  string
+		ok    bool
+	}{
+		{"[WARN] disk low", LVL_WARN, "disk low", true},
+		{"[warning]disk low", LVL_WARN, "disk low", true},
+		{"error: failed", LVL_ERROR, "failed", true},
+		{"DBG:x", LVL_DEBUG, "x", true},
+		{"[UNKNOWN] x", 0, "", false},
+		{"[note] x", 0, "", false},
+		{"[WARN x", 0, "", false},
+		{"time is 10:20", 0, "", false},
+		{"plain", 0, "", false},
+	}
+	for _, tt := range tests {
+		level, rest, ok := parseLevelToken([]byte(tt.line))
+		assert.Equal(t, tt.ok, ok, tt.line)
+		if ok {
+			assert.Equal(t, tt.level, level, tt.line)
+			assert.Equal(t, tt.rest, string(rest), tt.line)
+		}
+	}
+}
+
+func Test_skipStdHeader(t *testing.T) {
+	for line, want := range map[string]string{
+		"2024/01/02 15:04:05 msg":        "msg",
+		"2024/01/02 15:04:05.123456 msg": "msg",
+		"15:04:05 msg":                   "msg",
+		"2024/01/02 msg":                 "msg",
+		"2024/01/0 msg":                  "2024/01/0 msg",
+		"15:04:05msg":                    "15:04:05msg",
+		"":                               "",
+	} {
+		assert.Equal(t, want, string(skipStdHeader([]byte(line))), line)
+	}
+}
+
+func Test_StdWriter(t *testing.T) {
+	out := &FakeWriter{}
+	l := InitWithParams(LVL_UNKNOWN, &FakeWriter{}, out)
+	l.SetOutputLevelPrefix(out, LevelShortNames, ":")
+	lc := l.NewClient("std")
+	l.Start(64)
+	w := NewStdWriter(lc, LVL_INFO).SetPrefix("lib: ").SetParseLevels(true)
+	std := log.New(w, "lib: ", log.LstdFlags|log.Lmicroseconds)
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() {
+			std.Println("[WARN] disk low")
+			std.Printf("started")
+		})
+	}
+	wg.Wait()
+	log.New(w, "lib: ", log.Ltime|log.Lmsgprefix).Print("error: failed")
+	NewStdLogger(lc, LVL_DEBUG, false).Print("[ERROR] as is")
+	l.StopAndWait()
+	s := out.String()
+	assert.Equal(t, 8, strings.Count(s, "WRN:std:disk low\n"))
+	assert.Equal(t, 8, strings.Count(s, "INF:std:started\n"))
+	assert.Contains(t, s, "ERR:std:failed\n")
+	assert.Contains(t, s, "DBG:std:[ERROR] as is\n")
+	n, err := w.Write([]byte("x\n"))
+	assert.Zero(t, n)
+	assert.EqualError(t, err, _ERROR_MESSAGE_LOGGER_INACTIVE)
+}
@@ -0,0 +1,164 @@
+package lgr
+
+/*
+Output write timeouts.
+
+A Write call on a blocked output (e.g. a full pipe or a hung network connection)
+never returns, so without a timeout it freezes the processing goroutine (or the
+writer goroutine of an async output) forever. With a write timeout set (see
+Logger.SetOutputWriteTimeout) a write that doesn't complete in time is treated
+as an error: it is counted (OutputStats.Timeouts), reported to the fallback and
+optionally disables the output (see Logger.SetOutputDisableOnTimeout and
+SetOutputRetry to probe it later).
+
+Outputs supporting write deadlines (net.Conn, pipes) get the deadline set for
+every write. Other outputs are written in a helper goroutine: on timeout the
+write is abandoned (the goroutine finishes when the Write returns) and further
+writes to the output are skipped until it returns, so the output is never
+written concurrently. Skipped writes are counted as errors and reported to the
+fallback with a single notice once the abandoned write returns.
+*/
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	_ERROR_MESSAGE_WRITE_TIMEOUT  = "output write timed out"
+	_ERROR_MESSAGE_WRITE_BLOCKED  = "output is blocked by a timed out write"
+	_WRITES_SKIPPED_NOTICE_SUFFIX = " writes skipped while a timed out write was blocking the output"
+)
+
+// ErrWriteTimeout is the cause of errors reported for output writes that exceed
+// the output write timeout (including writes attempted while a timed out write is
+// still in progress).
+var ErrWriteTimeout = errors.New(_ERROR_MESSAGE_WRITE_TIMEOUT)
+
+// errWriteBlocked is returned for writes skipped while a timed out write is still in
+// progress (caused by ErrWriteTimeout). Such errors are not written to the fallback
+// one by one (see reportSkipped).
+var errWriteBlocked = &causedError{_ERROR_MESSAGE_WRITE_BLOCKED, ErrWriteTimeout}
+
+// deadliner is implemented by outputs supporting write deadlines (like net.Conn).
+type deadliner interface {
+	SetWriteDeadline(t time.Time) error
+}
+
+// outTimeout holds the write timeout settings and state of an output.
+type outTimeout struct {
+	limit   time.Duration // write timeout (zero for no timeout)
+	disable bool          // whether to disable the output on timeout
+	pending chan struct{} // closed when the abandoned write returns (nil if none)
+	skipped uint64        // writes skipped while the abandoned write is pending
+}
+
+// Sets the write timeout for the specified output: a write that doesn't complete
+// within d is reported as an error caused by [ErrWriteTimeout]. Non-positive d
+// removes the timeout (default).
+//
+// The operation is protected by mutex for thread safety.
+func (l *Logger) SetOutputWriteTimeout(output OutType, d time.Duration) *Logger {
+	return l.changeOutSettings(output, func(c *outContext) {
+		c.timeout.limit = max(d, 0)
+	})
+}
+
+// Sets whether the specified output is disabled on a write timeout (like on a write
+// panic, see SetOutputWriteTimeout and SetOutputRetry). Off by default.
+//
+// The operation is protected by mutex for thread safety.
+func (l *Logger) SetOutputDisableOnTimeout(output OutType, disable bool) *Logger {
+	return l.changeOutSettings(output, func(c *outContext) {
+		c.timeout.disable = disable
+	})
+}
+
+// Writes the buffer content to the output with the output write timeout (if set).
+// Called by the goroutine writing the output only.
+func (l *Logger) writeOutput(output OutType, context *outContext, buf *bytes.Buffer, pushed time.Time) (int64, error) {
+	if context == nil {
+		return writeBuffer(output, buf, pushed)
+	}
+	l.sync.outsMtx.RLock()
+	limit := context.timeout.limit
+	l.sync.outsMtx.RUnlock()
+	if context.timeout.pending != nil {
+		select {
+		case <-context.timeout.pending:
+			context.timeout.pending = nil
+			l.reportSkipped(context)
+		default:
+			// the output is still blocked by the abandoned write
+			buf.Reset()
+			return 0, errWriteBlocked
+		}
+	}
+	if limit <= 0 {
+		return writeBuffer(output, buf, pushed)
+	}
+	if dw, ok := output.(deadliner); ok && dw.SetWriteDeadline(time.Now().Add(limit)) == nil {
+		n, err := writeBuffer(output, buf, pushed)
+		dw.SetWriteDeadline(time.Time{})
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			err = ErrWriteTimeout
+		}
+		return n, err
+	}
+	return writeWithTimer(output, &context.timeout, buf, pushed, limit)
+}
+
+// Counts a write skipped while the abandoned write is pending (called by the
+// goroutine writing the output only).
+func (l *Logger) countSkipped(context *outContext) {
+	context.stats.errors.Add(1)
+	context.timeout.skipped++
+}
+
+// Writes the notice about writes skipped while the abandoned write was pending to
+// the fallback (called by the goroutine writing the output only).
+func (l *Logger) reportSkipped(context *outContext) {
+	n := context.timeout.skipped
+	if n == 0 {
+		return
+	}
+	context.timeout.skipped = 0
+	l.sync.outsMtx.RLock()
+	name := context.name
+	l.sync.outsMtx.RUnlock()
+	l.handleLogWriteError("output " + name + ": " + strconv.FormatUint(n, 10) + _WRITES_SKIPPED_NOTICE_SUFFIX)
+}
+
+// Writes the buffer content in a helper goroutine and waits for it up to the limit.
+// Panics of the write are passed to the caller if the write is not abandoned.
+func writeWithTimer(output OutType, state *outTimeout, buf *bytes.Buffer, pushed time.Time, limit time.Duration) (int64, error) {
+	data := bytes.Clone(buf.Bytes()) // buf is reused by the caller after timeout
+	buf.Reset()
+	done := make(chan struct{})
+	var n int64
+	var err error
+	var panicked any
+	go func() {
+		defer close(done)
+		defer func() {
+			// panics of abandoned writes are lost (the output is failed anyway)
+			panicked = recover()
+		}()
+		n, err = writeBuffer(output, bytes.NewBuffer(data), pushed)
+	}()
+	timer := time.NewTimer(limit)
+	defer timer.Stop()
+	select {
+	case <-done:
+		if panicked != nil {
+			panic(panicked)
+		}
+		return n, err
+	case <-timer.C:
+		state.pending = done
+		return 0, ErrWriteTimeout
+	}
+}
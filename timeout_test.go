@@ -0,0 +1,88 @@
+package lgr
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Logger_SetOutputWriteTimeout(t *testing.T) {
+	const timeout = 10 * time.Millisecond
+	out, ferr := NewGateWriter(), &FakeWriter{}
+	l := InitWithParams(LVL_UNKNOWN, ferr, out)
+	l.msgbuf = bytes.NewBuffer(make([]byte, DEFAULT_OUT_BUFF))
+	l.SetOutputWriteTimeout(out, timeout)
+	assert.Equal(t, timeout, l.outputs[out].timeout.limit)
+	msg := &logMessage{msgtype: _MSG_LOG_TEXT, msgdata: []byte("a"), annex: basetype(LVL_INFO)}
+
+	t0 := time.Now()
+	_, err := l.logTextData(out, msg, false)
+	assert.GreaterOrEqual(t, time.Since(t0), timeout)
+	assert.ErrorIs(t, err, ErrWriteTimeout)
+	l.outputWritten(out, l.outputs[out], false, false, err)
+	t0 = time.Now()
+	for range 3 {
+		l.logTextToOutputs(msg)
+	}
+	assert.Less(t, time.Since(t0), timeout, "blocked output is written again")
+	assert.True(t, l.IsOutputEnabled(out), "output is disabled")
+	s := l.Stats().Outputs[0]
+	assert.Equal(t, uint64(1), s.Timeouts, "wrong number of timeouts")
+	assert.Equal(t, uint64(4), s.Errors)
+	assert.Equal(t, 1, strings.Count(ferr.String(), "\n"), "skipped writes are reported one by one")
+	assert.Contains(t, ferr.String(), _ERROR_MESSAGE_WRITE_TIMEOUT)
+
+	out.Open()
+	<-l.outputs[out].timeout.pending
+	msg.msgdata = []byte("b")
+	l.logTextToOutputs(msg)
+	assert.Equal(t, "a\nb\n", out.String(), "abandoned write is lost or repeated")
+	assert.Nil(t, l.outputs[out].timeout.pending)
+	assert.Contains(t, ferr.String(), "output output1: 3"+_WRITES_SKIPPED_NOTICE_SUFFIX)
+
+	l.SetOutputWriteTimeout(out, -time.Second)
+	assert.Zero(t, l.outputs[out].timeout.limit)
+}
+
+func Test_Logger_WriteTimeout_Disable(t *testing.T) {
+	out := NewGateWriter()
+	defer out.Open()
+	l, events := newHealthLogger(out)
+	l.SetOutputWriteTimeout(out, time.Millisecond).SetOutputDisableOnTimeout(out, true)
+	l.logTextToOutputs(&logMessage{msgtype: _MSG_LOG_TEXT, msgdata: []byte("a")})
+	assert.False(t, l.IsOutputEnabled(out), "output is not disabled on timeout")
+	assert.Equal(t, []outputStateEvent{{"output1", false, true}}, *events)
+	assert.Equal(t, uint64(1), l.Stats().Outputs[0].Timeouts)
+}
+
+func Test_Logger_WriteTimeout_Deadline(t *testing.T) {
+	conn, peer := net.Pipe() // writes block until read, deadlines are supported
+	defer peer.Close()
+	l := InitWithParams(LVL_UNKNOWN, &FakeWriter{}, conn)
+	l.msgbuf = bytes.NewBuffer(make([]byte, DEFAULT_OUT_BUFF))
+	l.SetOutputWriteTimeout(conn, 5*time.Millisecond)
+	msg := &logMessage{msgtype: _MSG_LOG_TEXT, msgdata: []byte("a")}
+	_, err := l.logTextData(conn, msg, false)
+	assert.ErrorIs(t, err, ErrWriteTimeout)
+	assert.Nil(t, l.outputs[conn].timeout.pending, "write is abandoned instead of deadline")
+	go func() {
+		buf := make([]byte, 16)
+		peer.Read(buf)
+	}()
+	_, err = l.logTextData(conn, msg, false)
+	assert.NoError(t, err, "deadline is not reset")
+}
+
+func Test_Logger_WriteTimeout_Panic(t *testing.T) {
+	out := &PanicWriter{}
+	l := InitWithParams(LVL_UNKNOWN, &FakeWriter{}, out)
+	l.msgbuf = bytes.NewBuffer(make([]byte, DEFAULT_OUT_BUFF))
+	l.SetOutputWriteTimeout(out, time.Second)
+	panicked, err := l.logTextData(out, &logMessage{msgtype: _MSG_LOG_TEXT}, false)
+	assert.True(t, panicked, "panic of timed write is lost")
+	assert.ErrorContains(t, err, panicStr)
+}
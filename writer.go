@@ -10,10 +10,23 @@ other formatting helpers. The semantics are:
 This allows patterns like:
   fmt.Fprintf(client.Lvl(LVL_WARN), "disk low: %d%%", percent)
 But remember that fmt is not thread-safe!
+
+Goroutine-safe alternative: client.Writer(level) returns a LevelWriter bound to
+the level. It assembles partial writes (from fmt, io.Copy etc.) into complete
+lines and queues every line as a separate message:
+  w := client.Writer(LVL_WARN)
+  fmt.Fprintf(w, "disk low: %d%%\n", percent)
 */
 
 package lgr
 
+import (
+	"bytes"
+	"sync"
+)
+
+const _LINE_BUFF_MAX = 64 << 10 // max length of an incomplete line kept by LevelWriter
+
 // Lvl sets the client's current level (used by Write/fmt.Fprintf) and returns
 // the same client for convenient chaining.
 func (lc *LogClient) Lvl(level LogLevel) *LogClient {
@@ -28,7 +41,8 @@ func (lc *LogClient) Lvl(level LogLevel) *LogClient {
 //
 //	fmt.Fprintf(client.Lvl(LVL_WARN), "disk low: %d%%", percent)
 //
-// but remember that fmt.Fprint*() functions are not thrtead-safe!
+// but remember that fmt.Fprint*() functions are not thrtead-safe! Use Writer(level)
+// for concurrent writes.
 func (lc *LogClient) Write(p []byte) (n int, err error) {
 	if p == nil {
 		return 0, nil
@@ -41,3 +55,71 @@ func (lc *LogClient) Write(p []byte) (n int, err error) {
 	}
 	return
 }
+
+// LevelWriter is a goroutine-safe io.Writer bound to a client and a level (see
+// LogClient.Writer). Every complete line is queued as a log message, incomplete
+// lines are buffered until the newline, Flush or the length limit. Concurrent
+// partial writes to the same writer are mixed, so every goroutine writing lines
+// in parts should use its own writer.
+type LevelWriter struct {
+	client *LogClient
+	level  LogLevel
+	mtx    sync.Mutex // guards buf
+	buf    []byte     // incomplete line
+}
+
+// Returns a new writer queuing lines as messages of the client with the provided
+// level. The level can't be changed, so the writer doesn't depend on Lvl calls.
+//
+// Preferred usage example:
+//
+//	w := client.Writer(LVL_INFO)
+//	defer w.Flush()
+//	io.Copy(w, cmdOutput)
+func (lc *LogClient) Writer(level LogLevel) *LevelWriter {
+	return &LevelWriter{client: lc, level: normLevel(level)}
+}
+
+// Write implements io.Writer. Complete lines are queued without the trailing
+// newline, the rest is buffered. On a queuing error the number of bytes of the
+// lines queued before is returned (the failed line is discarded).
+func (w *LevelWriter) Write(p []byte) (n int, err error) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			w.buf = append(w.buf, p...)
+			if len(w.buf) >= _LINE_BUFF_MAX {
+				if err = w.flush(); err != nil {
+					return n, err
+				}
+			}
+			return n + len(p), nil
+		}
+		w.buf = append(w.buf, p[:i]...)
+		if err = w.flush(); err != nil {
+			return n, err
+		}
+		n += i + 1
+		p = p[i+1:]
+	}
+	return n, nil
+}
+
+// Queues the buffered incomplete line (if any) as a log message.
+func (w *LevelWriter) Flush() error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	return w.flush()
+}
+
+// Queues the buffered line and clears the buffer (must be called with the mutex held).
+func (w *LevelWriter) flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	_, err := w.client.LogBytes_with_err(w.level, bytes.Clone(w.buf))
+	w.buf = w.buf[:0]
+	return err
+}
@@ -3,8 +3,11 @@ package lgr
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -89,3 +92,50 @@ func Test_LogClient_Write(t *testing.T) {
 		})
 	}
 }
+
+func Test_LogClient_Writer(t *testing.T) {
+	out := &FakeWriter{}
+	l := InitWithParams(LVL_UNKNOWN, &FakeWriter{}, out)
+	l.SetOutputLevelPrefix(out, LevelShortNames, ":")
+	lc := l.NewClient("w")
+	l.Start(64)
+	warn, info := lc.Writer(LVL_WARN), lc.Writer(LVL_INFO)
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Go(func() {
+			w := lc.Writer(LVL_DEBUG) // partial writes need own writer
+			fmt.Fprintf(w, "part %d", i)
+			fmt.Fprintf(w, " of line\n")
+			fmt.Fprintln(warn, "warning")
+			fmt.Fprintln(info, "info")
+		})
+	}
+	wg.Wait()
+	n, err := io.Copy(info, strings.NewReader("a\nb\n\nc"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(6), n)
+	assert.NoError(t, info.Flush())
+	assert.NoError(t, info.Flush(), "flush of empty buffer")
+	l.StopAndWait()
+	s := out.String()
+	for i := range 8 {
+		assert.Contains(t, s, "DBG:w:part "+strconv.Itoa(i)+" of line\n")
+	}
+	assert.Equal(t, 8, strings.Count(s, "WRN:w:warning\n"))
+	assert.Equal(t, 8, strings.Count(s, "INF:w:info\n"))
+	assert.Contains(t, s, "INF:w:a\nINF:w:b\nINF:w:c\n", "empty line is not skipped")
+
+	t.Run("errors", func(t *testing.T) {
+		w := lc.Writer(LVL_INFO)
+		n, err := w.Write([]byte("x"))
+		assert.NoError(t, err, "incomplete line is not buffered")
+		assert.Equal(t, 1, n)
+		assert.ErrorContains(t, w.Flush(), _ERROR_MESSAGE_LOGGER_INACTIVE)
+		n, err = w.Write([]byte("y\nz\n"))
+		assert.ErrorContains(t, err, _ERROR_MESSAGE_LOGGER_INACTIVE)
+		assert.Zero(t, n)
+		n, err = w.Write(make([]byte, _LINE_BUFF_MAX))
+		assert.Error(t, err, "long line is not flushed")
+		assert.Zero(t, n)
+	})
+}